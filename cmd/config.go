@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+// loadConfig returns the certificates of the config file or of --certificate, which share a ca, or a single
+// certificate when there are none. Flags of cmd that were set explicitly override the values of every certificate,
+// and flag defaults fill in values that the file leaves empty. Certificates without a namespace get namespace, if
+// set, which host templates can then use.
+func loadConfig(cmd *cobra.Command, namespace string) (*config.Config, error) {
+	c := &config.Config{}
+	if cfg.configFile != "" {
+		loaded, err := config.Load(cfg.configFile)
+		if err != nil {
+			return nil, err
+		}
+		c = loaded
+	}
+	flags := cmd.Flags()
+	if len(cfg.certificates) > 0 {
+		if len(c.Certificates) > 0 {
+			return nil, errors.New("certificate cannot be combined with the certificates of a config file")
+		}
+		if flags.Changed("secret-name") || flags.Changed("host") {
+			return nil, errors.New("certificate cannot be combined with secret-name and host")
+		}
+		certificates, err := parseCertificates(cfg.certificates)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates, c.SharedCA = certificates, true
+	}
+	if len(c.Certificates) == 0 {
+		c.Certificates = []config.Certificate{{}}
+	}
+
+	for i := range c.Certificates {
+		if err := applyFlags(flags, &c.Certificates[i]); err != nil {
+			return nil, err
+		}
+	}
+	overrideString(flags, "cluster-domain", &c.ClusterDomain, cfg.clusterDomain)
+	c.SetDefaults()
+
+	for i := range c.Certificates {
+		if c.Certificates[i].Namespace == "" {
+			c.Certificates[i].Namespace = namespace
+		}
+	}
+
+	if err := c.ExpandHosts(); err != nil {
+		return nil, err
+	}
+	if err := c.NormalizeHosts(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// certificates returns the validated certificates for commands using the Kubernetes API, which need a namespace
+// for each secret.
+func certificates(cmd *cobra.Command) ([]config.Certificate, error) {
+	c, err := validConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return c.Certificates, nil
+}
+
+// validConfig returns the validated config for commands using the Kubernetes API, where certificates without a
+// namespace default to the namespace of the pod.
+func validConfig(cmd *cobra.Command) (*config.Config, error) {
+	c, err := loadConfig(cmd, k8s.InClusterNamespace())
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	for i := range c.Certificates {
+		if c.Certificates[i].Namespace == "" {
+			return nil, errors.Errorf("no namespace for secret %s", c.Certificates[i].SecretName)
+		}
+	}
+	return c, nil
+}
+
+// parseCertificates parses --certificate values of the form secret-name=host,host.
+func parseCertificates(values []string) ([]config.Certificate, error) {
+	certificates := make([]config.Certificate, 0, len(values))
+	for _, v := range values {
+		name, hosts, ok := strings.Cut(v, "=")
+		if !ok || name == "" || hosts == "" {
+			return nil, errors.Errorf("invalid certificate '%s', expected secret-name=host,host", v)
+		}
+		certificates = append(certificates, config.Certificate{SecretName: name, Hosts: splitNonEmpty(hosts)})
+	}
+	return certificates, nil
+}
+
+// addClusterDomainFlag adds the flag setting the cluster domain of host templates.
+func addClusterDomainFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.clusterDomain, "cluster-domain", config.DefaultClusterDomain, "Domain of the cluster that hosts can use as {{ .ClusterDomain }}")
+}
+
+// addCertificateFlag adds the flag listing certificates that share a ca.
+func addCertificateFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&cfg.certificates, "certificate", nil, "Secret name and comma-separated hosts of a certificate signed by a ca shared with the other certificates: e.g. webhook-a=a.default.svc. May be repeated instead of setting 'secret-name' and 'host'")
+}
+
+func applyFlags(flags *pflag.FlagSet, cert *config.Certificate) error {
+	overrideString(flags, "secret-name", &cert.SecretName, cfg.secretName)
+	overrideString(flags, "namespace", &cert.Namespace, cfg.namespace)
+	overrideList(flags, "host", &cert.Hosts, cfg.host)
+	overrideString(flags, "ca-name", &cert.CAName, cfg.caName)
+	overrideString(flags, "cert-name", &cert.CertName, cfg.certName)
+	overrideString(flags, "key-name", &cert.KeyName, cfg.keyName)
+	if f := flags.Lookup("ca-name-constraints"); f != nil && f.Changed {
+		cert.NameConstraints = cfg.caNameConstraints
+	}
+	if f := flags.Lookup("intermediate-ca"); f != nil && f.Changed {
+		cert.Intermediate = cfg.intermediateCA
+	}
+	if flags.Changed("signer-cert-file") || flags.Changed("signer-key-file") {
+		cert.Signer = &config.Signer{CertFile: cfg.signerCertFile, KeyFile: cfg.signerKeyFile}
+	}
+	if flags.Changed("client-common-name") || flags.Changed("client-organization") || flags.Changed("client-secret-name") {
+		if cert.Client == nil {
+			cert.Client = &config.Client{}
+		}
+		overrideString(flags, "client-secret-name", &cert.Client.SecretName, cfg.clientSecretName)
+		overrideString(flags, "client-common-name", &cert.Client.Subject.CommonName, cfg.clientCommonName)
+		overrideList(flags, "client-organization", &cert.Client.Subject.Organization, cfg.clientOrganization)
+	}
+	if flags.Changed("keystore-name") || flags.Changed("truststore-name") || flags.Changed("truststore-format") ||
+		flags.Changed("keystore-password-secret") || flags.Changed("keystore-password-name") {
+		if cert.Keystore == nil {
+			cert.Keystore = &config.Keystore{}
+		}
+		overrideString(flags, "keystore-name", &cert.Keystore.Name, cfg.keystoreName)
+		overrideString(flags, "truststore-name", &cert.Keystore.TruststoreName, cfg.truststoreName)
+		overrideString(flags, "truststore-format", &cert.Keystore.TruststoreFormat, cfg.truststoreFormat)
+		overrideString(flags, "keystore-password-name", &cert.Keystore.PasswordName, cfg.keystorePasswordName)
+		if flags.Changed("keystore-password-secret") {
+			cert.Keystore.PasswordSecret = &config.SecretKey{Name: cfg.keystorePasswordSecret, Key: cfg.keystorePasswordKey}
+		}
+	}
+	if flags.Changed("key-passphrase-secret") || flags.Changed("key-passphrase-file") || flags.Changed("encrypted-key-name") {
+		if cert.EncryptedKey == nil {
+			cert.EncryptedKey = &config.EncryptedKey{}
+		}
+		overrideString(flags, "encrypted-key-name", &cert.EncryptedKey.Name, cfg.encryptedKeyName)
+		if flags.Changed("key-passphrase-secret") {
+			cert.EncryptedKey.PassphraseSecret = &config.SecretKey{Name: cfg.keyPassphraseSecret, Key: cfg.keyPassphraseKey}
+			cert.EncryptedKey.PassphraseFile = ""
+		}
+		if flags.Changed("key-passphrase-file") {
+			cert.EncryptedKey.PassphraseFile = cfg.keyPassphraseFile
+			cert.EncryptedKey.PassphraseSecret = nil
+		}
+	}
+	overrideString(flags, "ca-common-name", &cert.CASubject.CommonName, cfg.caCommonName)
+	overrideList(flags, "ca-organization", &cert.CASubject.Organization, cfg.caOrganization)
+	overrideList(flags, "ca-organizational-unit", &cert.CASubject.OrganizationalUnit, cfg.caOrganizationalUnit)
+	overrideString(flags, "common-name", &cert.Subject.CommonName, cfg.commonName)
+	overrideList(flags, "organization", &cert.Subject.Organization, cfg.organization)
+	overrideList(flags, "organizational-unit", &cert.Subject.OrganizationalUnit, cfg.organizationalUnit)
+	overrideString(flags, "secret-type", &cert.Type, cfg.secretType)
+	overrideMap(flags, "secret-labels", &cert.Labels, cfg.secretLabels)
+	overrideMap(flags, "secret-annotations", &cert.Annotations, cfg.secretAnnotations)
+	if f := flags.Lookup("owner-reference"); f != nil && f.Changed {
+		owner, err := ownerReference(cfg.ownerReference)
+		if err != nil {
+			return err
+		}
+		cert.OwnerReference = owner
+	}
+
+	p := &cert.Patch
+	overrideString(flags, "webhook-name", &p.WebhookName, cfg.webhookName)
+	overrideBool(flags, "patch-validating", &p.Validating, cfg.patchValidating)
+	overrideBool(flags, "patch-mutating", &p.Mutating, cfg.patchMutating)
+	overrideBool(flags, "validating", &p.Validating, cfg.patchValidating)
+	overrideBool(flags, "mutating", &p.Mutating, cfg.patchMutating)
+	overrideString(flags, "patch-failure-policy", &p.FailurePolicy, cfg.patchFailurePolicy)
+	overrideString(flags, "admission-registration-version", &p.AdmissionRegistrationVersion, cfg.admissionRegistrationVersion)
+	overrideList(flags, "crds", &p.CRDs, cfg.crds)
+	overrideList(flags, "crd-api-groups", &p.CRDAPIGroups, cfg.crdAPIGroups)
+	overrideList(flags, "apiservices", &p.APIServices, cfg.apiServices)
+	overrideString(flags, "ca-bundle", &p.CABundle, cfg.caBundle)
+	return nil
+}
+
+// overrideString sets field to value when the flag was set explicitly, or when field is empty.
+func overrideString(flags *pflag.FlagSet, name string, field *string, value string) {
+	if f := flags.Lookup(name); f != nil && (f.Changed || *field == "") {
+		*field = value
+	}
+}
+
+// overrideList sets field to the comma-separated value when the flag was set explicitly, or when field is empty.
+func overrideList(flags *pflag.FlagSet, name string, field *[]string, value string) {
+	if f := flags.Lookup(name); f != nil && (f.Changed || len(*field) == 0) {
+		*field = splitNonEmpty(value)
+	}
+}
+
+// overrideBool sets field to value when the flag was set explicitly, or when field is not set.
+func overrideBool(flags *pflag.FlagSet, name string, field **bool, value bool) {
+	if f := flags.Lookup(name); f != nil && (f.Changed || *field == nil) {
+		*field = &value
+	}
+}
+
+// overrideMap sets field to value when the flag was set explicitly, or when field is empty.
+func overrideMap(flags *pflag.FlagSet, name string, field *map[string]string, value map[string]string) {
+	if f := flags.Lookup(name); f != nil && (f.Changed || len(*field) == 0) {
+		*field = value
+	}
+}
+
+// ownerReference parses the apiVersion, kind, name and uid of the owner-reference flag.
+func ownerReference(m map[string]string) (*config.OwnerReference, error) {
+	owner := &config.OwnerReference{}
+	for k, v := range m {
+		switch k {
+		case "apiVersion":
+			owner.APIVersion = v
+		case "kind":
+			owner.Kind = v
+		case "name":
+			owner.Name = v
+		case "uid":
+			owner.UID = v
+		default:
+			return nil, errors.Errorf("unknown owner-reference field '%s'", k)
+		}
+	}
+	return owner, nil
+}
+
+// caBundle returns the certificates of the ca of a secret to patch into the objects selected by p.
+func caBundle(ca []byte, p *config.Patch) ([]byte, error) {
+	if p.CABundle == config.CABundleChain {
+		return ca, nil
+	}
+	return certs.RootCertificates(ca)
+}
+
+// addCABundleFlag adds the flag selecting the certificates of the ca to patch.
+func addCABundleFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.caBundle, "ca-bundle", config.CABundleRoot, "Certificates of the ca to put into caBundles: root|chain, where chain includes intermediate cas")
+}
+
+// patchOptions returns the objects selected by p.
+func patchOptions(p *config.Patch) k8s.PatchOptions {
+	return k8s.PatchOptions{
+		WebhookName:                  p.WebhookName,
+		Validating:                   p.PatchValidating(),
+		Mutating:                     p.PatchMutating(),
+		FailurePolicy:                p.FailurePolicy,
+		AdmissionRegistrationVersion: k8s.AdmissionRegistrationVersion(p.AdmissionRegistrationVersion),
+		CRDs:                         p.CRDs,
+		CRDAPIGroups:                 p.CRDAPIGroups,
+		APIServices:                  p.APIServices,
+	}
+}
+
+func splitNonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
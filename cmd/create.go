@@ -2,66 +2,518 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
 	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
 )
 
+// leaseDuration is how long a lock is held at most when its holder does not release it.
+const leaseDuration = 30 * time.Second
+
+const (
+	certNameUsage = "Name of cert file in the secret. Defaults to cert, or tls.crt for kubernetes.io/tls secrets"
+	keyNameUsage  = "Name of key file in the secret. Defaults to key, or tls.key for kubernetes.io/tls secrets"
+)
+
 var create = &cobra.Command{
 	Use:    "create",
 	Short:  "Generate a ca and server cert+key and store the results in a secret 'secret-name' in 'namespace'",
-	Long:   "Generate a ca and server cert+key and store the results in a secret 'secret-name' in 'namespace'",
+	Long:   "Generate a ca and server cert+key and store the results in a secret 'secret-name' in 'namespace', or in files in 'output-dir' without using the Kubernetes API",
 	PreRun: configureLogging,
-	RunE:   createCommand,
+	RunE:   instrument("create", createCommand),
 }
 
-func createCommand(_ *cobra.Command, _ []string) error {
-	k, err := k8s.New(newKubernetesClients(cfg.kubeconfig))
+func createCommand(cmd *cobra.Command, _ []string) error {
+	if cfg.outputDir != "" {
+		return createFiles(cmd)
+	}
+
+	c, err := validConfig(cmd)
 	if err != nil {
 		return err
 	}
-	ca, err := k.GetCaFromSecret(cfg.secretName, cfg.namespace, cfg.caName)
+	k, err := newKubernetes(cfg.kubeconfig)
 	if err != nil {
 		return err
 	}
-	if ca == nil {
-		log.Infof("creating new secret %s/%s", cfg.namespace, cfg.secretName)
-		newCa, newCert, newKey, err := certs.GenerateCerts(cfg.host)
+	ctx, cancel := operationContext(cmd)
+	defer cancel()
+	_, err = ensureSecrets(ctx, k, c)
+	return err
+}
+
+// ensureSecrets runs ensureSecret for every certificate of c, or ensureSharedSecrets when they share a ca, and
+// returns the ca of each secret.
+func ensureSecrets(ctx context.Context, k k8s.Interface, c *config.Config) ([][]byte, error) {
+	if c.SharedCA {
+		return ensureSharedSecrets(ctx, k, c.Certificates)
+	}
+	cas := make([][]byte, len(c.Certificates))
+	for i := range c.Certificates {
+		ca, err := ensureSecret(ctx, k, &c.Certificates[i])
 		if err != nil {
-			return err
+			return nil, err
 		}
-		ca = newCa
-		if err := k.SaveCertsToSecret(
-			context.Background(),
-			cfg.secretName,
-			cfg.namespace,
-			cfg.caName,
-			cfg.certName,
-			cfg.keyName,
-			ca,
-			newCert,
-			newKey,
-		); err != nil {
-			return err
+		cas[i] = ca
+	}
+	return cas, nil
+}
+
+// ensureSecret generates certificates into the secret unless it already holds a ca, cert and key, and returns the
+// ca of the secret. A secret that exists without them, e.g. one templated by a chart, is filled in.
+func ensureSecret(ctx context.Context, k k8s.Interface, c *config.Certificate) ([]byte, error) {
+	if cfg.lock {
+		held, unlock, err := lockSecret(ctx, k, c)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		ctx = held
+	}
+
+	ref := secretRef(c)
+	existing, err := k.GetCerts(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Complete() {
+		if err := checkClientSecret(ctx, k, c); err != nil {
+			return nil, err
+		}
+		if err := ensureExtraData(ctx, k, c, existing); err != nil {
+			return nil, err
 		}
-	} else {
-		log.Infof("secret %s/%s already exists", cfg.namespace, cfg.secretName)
+		log.Infof("secret %s already exists", ref)
+		observeCertificate(c, existing)
+		return existing.CA, nil
+	}
+	if existing != nil && (existing.CA != nil || existing.Cert != nil || existing.Key != nil) {
+		log.Warnf("secret %s holds only some of '%s', '%s' and '%s', replacing them", ref, c.CAName, c.CertName, c.KeyName)
+	}
+
+	log.Infof("generating certificates into secret %s", ref)
+	generated, client, err := generateCerts(c)
+	if err != nil {
+		return nil, err
+	}
+	// The client secret is saved first, so that a run failing in between issues both again.
+	if client != nil {
+		log.Infof("generating client certificate into secret %s", clientRef(c))
+		if err := saveClientCerts(ctx, k, c, client); err != nil {
+			return nil, err
+		}
+	}
+	opts, err := withExtraData(ctx, k, c, generated, secretOptions(c))
+	if err != nil {
+		return nil, err
+	}
+	if err := k.SaveCerts(ctx, ref, generated, existing, opts...); err != nil {
+		if !errors.Is(err, k8s.ErrConflict) {
+			return nil, err
+		}
+		// Another run wrote the secret since it was read: use its certificates instead.
+		log.Infof("secret %s was written concurrently, using its certificates", ref)
+		winner, getErr := k.GetCerts(ctx, ref)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if !winner.Complete() {
+			return nil, err
+		}
+		generated = winner
+	}
+	observeCertificate(c, generated)
+
+	return generated.CA, nil
+}
+
+// ensureSharedSecrets generates certificates signed by one ca into the secrets of certificates unless they all hold
+// a ca, cert and key already, and returns the ca of each secret. The ca key is not kept, so when only some of the
+// secrets exist, the others cannot be issued. With --lock, runs hold the locks of every secret, so that concurrent
+// runs do not mix the certificates of different cas.
+func ensureSharedSecrets(ctx context.Context, k k8s.Interface, certificates []config.Certificate) ([][]byte, error) {
+	if cfg.lock {
+		held, unlock, err := lockSecrets(ctx, k, certificates)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		ctx = held
 	}
 
+	cas := make([][]byte, len(certificates))
+	stored := make([]*k8s.Certs, len(certificates))
+	var missing []string
+	for i := range certificates {
+		c := &certificates[i]
+		existing, err := k.GetCerts(ctx, secretRef(c))
+		if err != nil {
+			return nil, err
+		}
+		stored[i] = existing
+		if !existing.Complete() {
+			missing = append(missing, secretRef(c).String())
+			continue
+		}
+		if err := checkClientSecret(ctx, k, c); err != nil {
+			return nil, err
+		}
+		if err := ensureExtraData(ctx, k, c, existing); err != nil {
+			return nil, err
+		}
+		cas[i] = existing.CA
+	}
+	switch len(missing) {
+	case 0:
+		for i := range certificates {
+			log.Infof("secret %s already exists", secretRef(&certificates[i]))
+			observeCertificate(&certificates[i], stored[i])
+		}
+		return cas, nil
+	case len(certificates):
+	default:
+		return nil, errors.Errorf("secrets %s do not exist but the secrets sharing their ca do, delete those to issue all with a new ca", strings.Join(missing, ", "))
+	}
+
+	ca, err := newSharedSigner(certificates)
+	if err != nil {
+		return nil, err
+	}
+	for i := range certificates {
+		c := &certificates[i]
+		log.Infof("generating certificates into secret %s", secretRef(c))
+		server, client, err := issueCerts(ca, c)
+		if err != nil {
+			return nil, err
+		}
+		if client != nil {
+			if err := saveClientCerts(ctx, k, c, client); err != nil {
+				return nil, err
+			}
+		}
+		opts, err := withExtraData(ctx, k, c, server, secretOptions(c))
+		if err != nil {
+			return nil, err
+		}
+		if err := k.SaveCerts(ctx, secretRef(c), server, stored[i], opts...); err != nil {
+			return nil, err
+		}
+		observeCertificate(c, server)
+		cas[i] = server.CA
+	}
+	return cas, nil
+}
+
+// checkClientSecret fails when c has a client certificate whose secret is missing or incomplete. The ca key is not
+// kept, so the client certificate can only be issued together with the serving certificate.
+func checkClientSecret(ctx context.Context, k k8s.SecretStore, c *config.Certificate) error {
+	if c.Client == nil {
+		return nil
+	}
+	client, err := k.GetCerts(ctx, clientRef(c))
+	if err != nil {
+		return err
+	}
+	if !client.Complete() {
+		return errors.Errorf("secret %s has no client certificate in %s, delete it to issue both with a new ca", secretRef(c), clientRef(c))
+	}
 	return nil
 }
 
+// saveClientCerts saves the client certificate of c into its secret, replacing the one it may hold. Without the lock
+// of c, a concurrent run may replace it in turn, so the secret is read right before.
+func saveClientCerts(ctx context.Context, k k8s.SecretStore, c *config.Certificate, client *k8s.Certs) error {
+	observed, err := k.GetCerts(ctx, clientRef(c))
+	if err != nil {
+		return err
+	}
+	return k.SaveCerts(ctx, clientRef(c), client, observed, secretOptions(c)...)
+}
+
+// generateCerts generates a serving certificate and key for the hosts of c, signed by the ca of newSigner, and a
+// client certificate and key when c has one. The ca is returned with its chain up to the root.
+func generateCerts(c *config.Certificate) (server, client *k8s.Certs, err error) {
+	ca, err := newSigner(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	return issueCerts(ca, c)
+}
+
+// issueCerts issues the serving certificate of c and its client certificate, if any, with ca.
+func issueCerts(ca *certs.CA, c *config.Certificate) (server, client *k8s.Certs, err error) {
+	if len(c.Hosts) == 0 {
+		return nil, nil, errors.Errorf("no hosts to generate a certificate for secret %s/%s", c.Namespace, c.SecretName)
+	}
+	cert, key, err := ca.Issue(certs.WithHosts(c.Hosts...), certs.WithSubject(c.Subject.Name()))
+	if err != nil {
+		return nil, nil, err
+	}
+	server = &k8s.Certs{CA: ca.Chain(), Cert: cert, Key: key}
+	if c.Client == nil {
+		return server, nil, nil
+	}
+
+	cert, key, err = ca.Issue(certs.WithClientAuth(), certs.WithSubject(c.Client.Subject.Name()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return server, &k8s.Certs{CA: server.CA, Cert: cert, Key: key}, nil
+}
+
+// newSharedSigner returns the signer of the first certificate, constrained to the hosts of all of them.
+func newSharedSigner(certificates []config.Certificate) (*certs.CA, error) {
+	c := certificates[0]
+	c.Hosts = nil
+	for i := range certificates {
+		c.Hosts = append(c.Hosts, certificates[i].Hosts...)
+	}
+	return newSigner(&c)
+}
+
+// newSigner loads the signer of c, or generates a ca and, when c asks for it, an intermediate ca signed by it.
+func newSigner(c *config.Certificate) (*certs.CA, error) {
+	if c.Signer != nil {
+		cert, err := os.ReadFile(c.Signer.CertFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading signer certificate")
+		}
+		key, err := os.ReadFile(c.Signer.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading signer key")
+		}
+		return certs.LoadCA(cert, key)
+	}
+
+	caOpts := []certs.Option{certs.WithSubject(c.CASubject.Name())}
+	if c.NameConstraints {
+		caOpts = append(caOpts, certs.WithNameConstraints(c.Hosts...))
+	}
+	if c.Intermediate {
+		caOpts = append(caOpts, certs.WithMaxPathLen(1))
+	}
+	ca, err := certs.NewCA(caOpts...)
+	if err != nil || !c.Intermediate {
+		return ca, err
+	}
+
+	subject := c.CASubject.Name()
+	subject.CommonName = ""
+	if cn := c.CASubject.CommonName + "-intermediate"; c.CASubject.CommonName != "" && len(cn) <= 64 {
+		subject.CommonName = cn
+	}
+	return ca.NewIntermediate(certs.WithSubject(subject))
+}
+
+// secretRef returns the secret of c and the keys of its ca, cert and key.
+func secretRef(c *config.Certificate) k8s.SecretRef {
+	return k8s.SecretRef{Namespace: c.Namespace, Name: c.SecretName, CAKey: c.CAName, CertKey: c.CertName, KeyKey: c.KeyName}
+}
+
+// clientRef returns the secret of the client certificate of c, which uses the keys of the secret of c.
+func clientRef(c *config.Certificate) k8s.SecretRef {
+	ref := secretRef(c)
+	ref.Name = c.Client.SecretName
+	return ref
+}
+
+// lockSecrets acquires the Leases of the secrets of certificates in namespace and name order, so that concurrent runs
+// over overlapping secrets cannot deadlock. Each lock is taken under the previous one, so the returned context is
+// cancelled when any of them is lost. The returned function releases them in reverse order.
+func lockSecrets(ctx context.Context, k k8s.Locker, certificates []config.Certificate) (context.Context, func(), error) {
+	sorted := make([]*config.Certificate, len(certificates))
+	for i := range certificates {
+		sorted[i] = &certificates[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Namespace != sorted[j].Namespace {
+			return sorted[i].Namespace < sorted[j].Namespace
+		}
+		return sorted[i].SecretName < sorted[j].SecretName
+	})
+
+	var unlocks []func()
+	unlock := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+	for _, c := range sorted {
+		held, unlockSecret, err := lockSecret(ctx, k, c)
+		if err != nil {
+			unlock()
+			return nil, nil, err
+		}
+		unlocks = append(unlocks, unlockSecret)
+		ctx = held
+	}
+	return ctx, unlock, nil
+}
+
+// lockSecret acquires a Lease named after the secret of c, so that concurrent runs generate its certificates
+// only once. The returned context is cancelled when the Lease is lost.
+func lockSecret(ctx context.Context, k k8s.Locker, c *config.Certificate) (context.Context, func(), error) {
+	holder, err := os.Hostname()
+	if err != nil {
+		holder = "kube-webhook-certgen"
+	}
+	holder = fmt.Sprintf("%s-%d", holder, os.Getpid())
+
+	return k.Lock(ctx, c.Namespace, c.SecretName+"-lock", holder, leaseDuration, cfg.lockTimeout)
+}
+
+// secretOptions returns the type and metadata of the secret of c.
+func secretOptions(c *config.Certificate) []k8s.SecretOption {
+	opts := []k8s.SecretOption{
+		k8s.WithSecretType(v1.SecretType(c.Type)),
+		k8s.WithLabels(c.Labels),
+		k8s.WithAnnotations(c.Annotations),
+	}
+	if o := c.OwnerReference; o != nil {
+		opts = append(opts, k8s.WithOwnerReference(metav1.OwnerReference{
+			APIVersion: o.APIVersion,
+			Kind:       o.Kind,
+			Name:       o.Name,
+			UID:        types.UID(o.UID),
+		}))
+	}
+	return opts
+}
+
+// createFiles generates certificates into the output directory unless its ca file already exists.
+func createFiles(cmd *cobra.Command) error {
+	c, err := loadConfig(cmd, "")
+	if err != nil {
+		return err
+	}
+	if len(c.Certificates) != 1 {
+		return errors.New("output-dir supports a single certificate")
+	}
+	if len(c.Certificates[0].Hosts) == 0 {
+		return errors.New("no hosts to generate a certificate for")
+	}
+	if c.Certificates[0].Keystore != nil || c.Certificates[0].EncryptedKey != nil {
+		return errors.New("output-dir does not support keystores and encrypted keys, which are stored in secrets")
+	}
+
+	files, err := outputFiles()
+	if err != nil {
+		return err
+	}
+	ca, _, _, err := files.Read()
+	if err != nil {
+		return err
+	}
+	if ca != nil {
+		log.Infof("certificates in %s already exist", files.Dir)
+		return nil
+	}
+
+	log.Infof("writing new certificates to %s", files.Dir)
+	generated, client, err := generateCerts(&c.Certificates[0])
+	if err != nil {
+		return err
+	}
+	// The client files are written first and without the ca, whose file marks the certificates as complete.
+	if client != nil {
+		clientFiles := files
+		clientFiles.CAName, clientFiles.CertName, clientFiles.KeyName = "", cfg.clientCertFile, cfg.clientKeyFile
+		if err := clientFiles.Write(nil, client.Cert, client.Key); err != nil {
+			return err
+		}
+	}
+	return files.Write(generated.CA, generated.Cert, generated.Key)
+}
+
+func outputFiles() (certs.Files, error) {
+	certMode, err := strconv.ParseUint(cfg.certFileMode, 8, 32)
+	if err != nil {
+		return certs.Files{}, errors.Wrapf(err, "invalid cert-file-mode '%s'", cfg.certFileMode)
+	}
+	keyMode, err := strconv.ParseUint(cfg.keyFileMode, 8, 32)
+	if err != nil {
+		return certs.Files{}, errors.Wrapf(err, "invalid key-file-mode '%s'", cfg.keyFileMode)
+	}
+	return certs.Files{
+		Dir:      cfg.outputDir,
+		CAName:   cfg.caFile,
+		CertName: cfg.certFile,
+		KeyName:  cfg.keyFile,
+		CertMode: os.FileMode(certMode),
+		KeyMode:  os.FileMode(keyMode),
+	}, nil
+}
+
+// addSecretFlags adds the flags setting the type and metadata of created secrets.
+func addSecretFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.secretType, "secret-type", config.SecretTypeOpaque, "Type of the secret: Opaque|kubernetes.io/tls")
+	cmd.Flags().StringToStringVar(&cfg.secretLabels, "secret-labels", nil, "Labels of the secret: e.g. app.kubernetes.io/managed-by=Helm")
+	cmd.Flags().StringToStringVar(&cfg.secretAnnotations, "secret-annotations", nil, "Annotations of the secret: e.g. meta.helm.sh/release-name=webhook")
+	cmd.Flags().StringToStringVar(&cfg.ownerReference, "owner-reference", nil, "Object owning the secret: apiVersion=apps/v1,kind=Deployment,name=webhook,uid=<uid>")
+}
+
+// addClientFlags adds the flags issuing a client certificate with the ca.
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.clientCommonName, "client-common-name", "", "If set, also issue a client certificate with this common name, e.g. for the API server to authenticate to the webhook")
+	cmd.Flags().StringVar(&cfg.clientOrganization, "client-organization", "", "Comma-separated organizations of the client certificate, which are the groups of the client")
+	cmd.Flags().StringVar(&cfg.clientSecretName, "client-secret-name", "", "Name of the secret of the client certificate. Defaults to 'secret-name' with a -client suffix")
+}
+
+// addProfileFlags adds the flags setting the subjects and constraints of generated certificates.
+func addProfileFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&cfg.caNameConstraints, "ca-name-constraints", false, "If true, limit the ca to issuing certificates for 'host' with X.509 name constraints")
+	cmd.Flags().BoolVar(&cfg.intermediateCA, "intermediate-ca", false, "If true, sign the certificate with an intermediate ca of a generated root and store the chain")
+	cmd.Flags().StringVar(&cfg.signerCertFile, "signer-cert-file", "", "If set, sign the certificate with the ca in this PEM file, optionally followed by its issuers up to the root")
+	cmd.Flags().StringVar(&cfg.signerKeyFile, "signer-key-file", "", "PEM file of the key of 'signer-cert-file'")
+	cmd.Flags().StringVar(&cfg.caCommonName, "ca-common-name", "", "Common name of the ca. Defaults to 'secret-name' with a -ca suffix")
+	cmd.Flags().StringVar(&cfg.caOrganization, "ca-organization", "", "Comma-separated organizations of the ca")
+	cmd.Flags().StringVar(&cfg.caOrganizationalUnit, "ca-organizational-unit", "", "Comma-separated organizational units of the ca")
+	cmd.Flags().StringVar(&cfg.commonName, "common-name", "", "Common name of the certificate. Defaults to the first 'host'")
+	cmd.Flags().StringVar(&cfg.organization, "organization", "", "Comma-separated organizations of the certificate")
+	cmd.Flags().StringVar(&cfg.organizationalUnit, "organizational-unit", "", "Comma-separated organizational units of the certificate")
+}
+
+// addLockFlags adds the flags serializing concurrent runs generating the same secret.
+func addLockFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&cfg.lock, "lock", false, "If true, hold the Lease '<secret-name>-lock' while generating the secret so that concurrent runs wait for each other")
+	cmd.Flags().DurationVar(&cfg.lockTimeout, "lock-timeout", 2*time.Minute, "How long to wait for the Lease held by a concurrent run")
+}
+
 func init() {
 	rootCmd.AddCommand(create)
-	create.Flags().StringVar(&cfg.host, "host", "", "Comma-separated hostnames and IPs to generate a certificate for")
+	create.Flags().StringVar(&cfg.host, "host", "", "Comma-separated DNS names, IPs and URIs to generate a certificate for: e.g. webhook.{{ .Namespace }}.svc,spiffe://${TRUST_DOMAIN}/ns/default")
+	addClusterDomainFlag(create)
 	create.Flags().StringVar(&cfg.secretName, "secret-name", "", "Name of the secret where certificate information will be written")
 	create.Flags().StringVar(&cfg.namespace, "namespace", "", "Namespace of the secret where certificate information will be written")
-	create.Flags().StringVar(&cfg.certName, "cert-name", "cert", "Name of cert file in the secret")
-	create.Flags().StringVar(&cfg.keyName, "key-name", "key", "Name of key file in the secret")
-	create.MarkFlagRequired("host")
-	create.MarkFlagRequired("secret-name")
-	create.MarkFlagRequired("namespace")
+	create.Flags().StringVar(&cfg.certName, "cert-name", "", certNameUsage)
+	create.Flags().StringVar(&cfg.keyName, "key-name", "", keyNameUsage)
+	addSecretFlags(create)
+	addCertificateFlag(create)
+	addProfileFlags(create)
+	addClientFlags(create)
+	addKeystoreFlags(create)
+	addEncryptedKeyFlags(create)
+	addLockFlags(create)
+	create.Flags().StringVar(&cfg.outputDir, "output-dir", "", "If set, write certificate files to this directory instead of a secret, without using the Kubernetes API")
+	create.Flags().StringVar(&cfg.caFile, "ca-file", "ca.crt", "Name of ca file in the output directory")
+	create.Flags().StringVar(&cfg.certFile, "cert-file", "tls.crt", "Name of cert file in the output directory")
+	create.Flags().StringVar(&cfg.keyFile, "key-file", "tls.key", "Name of key file in the output directory")
+	create.Flags().StringVar(&cfg.certFileMode, "cert-file-mode", "0644", "Octal permissions of the ca and cert files in the output directory")
+	create.Flags().StringVar(&cfg.clientCertFile, "client-cert-file", "client.crt", "Name of client cert file in the output directory")
+	create.Flags().StringVar(&cfg.clientKeyFile, "client-key-file", "client.key", "Name of client key file in the output directory")
+	create.Flags().StringVar(&cfg.keyFileMode, "key-file-mode", "0600", "Octal permissions of the key file in the output directory")
 }
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+func TestEnsureSecretWrittenConcurrently(t *testing.T) {
+	t.Parallel()
+
+	c := testCertificate("webhook", "webhook.default.svc")
+	ca, cert, key, err := certs.GenerateCerts("webhook.default.svc")
+	assert.NoError(t, err)
+	winner := &k8s.Certs{CA: ca, Cert: cert, Key: key, ResourceVersion: "winner"}
+
+	k := newFakeK8s()
+	k.beforeSave = func(ref k8s.SecretRef) {
+		if _, ok := k.secrets[ref.String()]; !ok {
+			k.secrets[ref.String()] = winner
+		}
+	}
+
+	got, err := ensureSecret(context.Background(), k, c)
+	assert.NoError(t, err)
+	assert.Equal(t, ca, got)
+	assert.Equal(t, winner, k.secrets[secretRef(c).String()])
+}
+
+func TestEnsureSharedSecretsAllMissing(t *testing.T) {
+	t.Parallel()
+
+	certificates := sharedCertificates()
+	certificates[0].Client = &config.Client{SecretName: "a-client", Subject: config.Subject{CommonName: "apiserver"}}
+	k := newFakeK8s()
+
+	cas, err := ensureSharedSecrets(context.Background(), k, certificates)
+	assert.NoError(t, err)
+	assert.Len(t, cas, 2)
+	assert.Equal(t, cas[0], cas[1])
+	for _, name := range []string{"a", "a-client", "b"} {
+		secret := k.secrets["default/"+name]
+		assert.True(t, secret.Complete(), name)
+		assert.Equal(t, cas[0], secret.CA, name)
+	}
+	// Secrets are locked only with --lock.
+	assert.Equal(t, []string{
+		"get default/a", "get default/b",
+		"get default/a-client", "save default/a-client", "save default/a", "save default/b",
+	}, k.calls)
+}
+
+func TestLockSecrets(t *testing.T) {
+	t.Parallel()
+
+	certificates := []config.Certificate{
+		*testCertificate("b", "b.default.svc"),
+		*testCertificate("a", "a.default.svc"),
+		*testCertificate("a", "a.other.svc"),
+	}
+	certificates[2].Namespace = "other"
+	k := newFakeK8s()
+
+	_, unlock, err := lockSecrets(context.Background(), k, certificates)
+	assert.NoError(t, err)
+	unlock()
+	// Locks are taken in namespace and name order, so that runs with overlapping secrets cannot deadlock.
+	assert.Equal(t, []string{
+		"lock default/a-lock", "lock default/b-lock", "lock other/a-lock",
+		"unlock other/a-lock", "unlock default/b-lock", "unlock default/a-lock",
+	}, k.calls)
+}
+
+func TestEnsureSharedSecretsAllPresent(t *testing.T) {
+	t.Parallel()
+
+	certificates := sharedCertificates()
+	k := newFakeK8s()
+	ca := storeSharedSecrets(t, k, certificates)
+
+	cas, err := ensureSharedSecrets(context.Background(), k, certificates)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{ca, ca}, cas)
+	assert.NotContains(t, k.calls, "save default/a")
+	assert.NotContains(t, k.calls, "save default/b")
+}
+
+func TestEnsureSharedSecretsPartiallyPresent(t *testing.T) {
+	t.Parallel()
+
+	certificates := sharedCertificates()
+	k := newFakeK8s()
+	storeSharedSecrets(t, k, certificates[:1])
+
+	_, err := ensureSharedSecrets(context.Background(), k, certificates)
+	assert.ErrorContains(t, err, "default/b")
+	assert.Nil(t, k.secrets["default/b"])
+	assert.NotContains(t, k.calls, "save default/a")
+}
+
+func TestEnsureSharedSecretsConflict(t *testing.T) {
+	t.Parallel()
+
+	certificates := sharedCertificates()
+	k := newFakeK8s()
+	winner := &k8s.Certs{CA: []byte("ca"), Cert: []byte("cert"), Key: []byte("key"), ResourceVersion: "winner"}
+	k.beforeSave = func(ref k8s.SecretRef) {
+		k.secrets[ref.String()] = winner
+	}
+
+	_, err := ensureSharedSecrets(context.Background(), k, certificates)
+	assert.ErrorIs(t, err, k8s.ErrConflict)
+	assert.Equal(t, winner, k.secrets["default/a"])
+	assert.Nil(t, k.secrets["default/b"])
+}
+
+func TestEnsureSharedSecretsClientSecret(t *testing.T) {
+	t.Parallel()
+
+	certificates := sharedCertificates()
+	certificates[1].Client = &config.Client{SecretName: "b-client", Subject: config.Subject{CommonName: "apiserver"}}
+	k := newFakeK8s()
+	storeSharedSecrets(t, k, certificates)
+
+	_, err := ensureSharedSecrets(context.Background(), k, certificates)
+	assert.ErrorContains(t, err, "default/b-client")
+
+	k.secrets["default/b-client"] = &k8s.Certs{CA: []byte("ca"), Cert: []byte("cert"), Key: []byte("key")}
+	_, err = ensureSharedSecrets(context.Background(), k, certificates)
+	assert.NoError(t, err)
+}
+
+// sharedCertificates returns two certificates sharing a ca, of secrets a and b in the default namespace.
+func sharedCertificates() []config.Certificate {
+	return []config.Certificate{*testCertificate("a", "a.default.svc"), *testCertificate("b", "b.default.svc")}
+}
+
+// storeSharedSecrets stores certificates issued by one ca into the secrets of certificates and returns the ca.
+func storeSharedSecrets(t *testing.T, k *fakeK8s, certificates []config.Certificate) []byte {
+	t.Helper()
+
+	ca, err := certs.NewCA()
+	assert.NoError(t, err)
+	for i := range certificates {
+		cert, key, err := ca.Issue(certs.WithHosts(certificates[i].Hosts...))
+		assert.NoError(t, err)
+		k.secrets[secretRef(&certificates[i]).String()] = &k8s.Certs{CA: ca.Certificate(), Cert: cert, Key: key}
+	}
+	return ca.Certificate()
+}
+
+// testCertificate returns a certificate of the secret in the default namespace for hosts, with the default keys.
+func testCertificate(secretName string, hosts ...string) *config.Certificate {
+	c := &config.Config{Certificates: []config.Certificate{{SecretName: secretName, Namespace: "default", Hosts: hosts}}}
+	c.SetDefaults()
+	return &c.Certificates[0]
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix is the prefix of the environment variables that set flags, e.g. CERTGEN_NAMESPACE for --namespace.
+const envPrefix = "CERTGEN_"
+
+// bindEnv sets every flag of cmd that was not given on the command line from its environment variable, if set.
+// Flags set this way count as set explicitly, so they take precedence over the config file.
+func bindEnv(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || f.Name == "help" {
+			return
+		}
+		name := envName(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return
+		}
+		if setErr := cmd.Flags().Set(f.Name, value); setErr != nil {
+			err = errors.Wrapf(setErr, "invalid value '%s' for %s", value, name)
+		}
+	})
+	return err
+}
+
+// envName returns the environment variable for a flag name.
+func envName(flag string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+// fakeK8s is an in-memory k8s.Interface that records the operations performed on it.
+type fakeK8s struct {
+	mu      sync.Mutex
+	secrets map[string]*k8s.Certs
+	data    map[string]map[string][]byte
+	bundles []k8s.CABundle
+	// saveErr, if set, is returned by SaveCerts instead of saving.
+	saveErr error
+	// beforeSave, if set, runs at the start of SaveCerts, e.g. to write the secret of a concurrent run.
+	beforeSave func(ref k8s.SecretRef)
+	// version is the resourceVersion of the last saved secret. Saves fail with k8s.ErrConflict unless they observed
+	// the stored version.
+	version int
+	// pingErr, if set, is returned by Ping.
+	pingErr error
+	// calls are the operations in the order they were performed, e.g. "lock default/webhook-lock".
+	calls []string
+}
+
+var _ k8s.Interface = (*fakeK8s)(nil)
+
+func newFakeK8s() *fakeK8s {
+	return &fakeK8s{secrets: map[string]*k8s.Certs{}, data: map[string]map[string][]byte{}}
+}
+
+func (f *fakeK8s) record(call string) {
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeK8s) GetCerts(_ context.Context, ref k8s.SecretRef) (*k8s.Certs, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("get " + ref.String())
+	return f.secrets[ref.String()], nil
+}
+
+func (f *fakeK8s) SaveCerts(_ context.Context, ref k8s.SecretRef, certs, observed *k8s.Certs, _ ...k8s.SecretOption) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("save " + ref.String())
+	if f.beforeSave != nil {
+		f.beforeSave(ref)
+	}
+	if f.saveErr != nil {
+		return f.saveErr
+	}
+	stored := f.secrets[ref.String()]
+	if (stored == nil) != (observed == nil) || stored != nil && stored.ResourceVersion != observed.ResourceVersion {
+		return errors.Wrapf(k8s.ErrConflict, "secret %s was written concurrently", ref)
+	}
+	f.version++
+	saved := *certs
+	saved.ResourceVersion = strconv.Itoa(f.version)
+	f.secrets[ref.String()] = &saved
+	return nil
+}
+
+func (f *fakeK8s) GetSecretData(_ context.Context, namespace, name string) (map[string][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("data " + namespace + "/" + name)
+	return f.data[namespace+"/"+name], nil
+}
+
+func (f *fakeK8s) GetCABundles(context.Context, k8s.PatchOptions) ([]k8s.CABundle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bundles, nil
+}
+
+func (f *fakeK8s) PatchCABundles(_ context.Context, ca []byte, _ k8s.PatchOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.bundles {
+		f.bundles[i].CABundle = ca
+	}
+	return nil
+}
+
+func (f *fakeK8s) Lock(ctx context.Context, namespace, name, _ string, _, _ time.Duration) (context.Context, func(), error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.record("lock " + namespace + "/" + name)
+	return ctx, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.record("unlock " + namespace + "/" + name)
+	}, nil
+}
+
+func (f *fakeK8s) Ping(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pingErr
+}
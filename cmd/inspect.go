@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+var inspect = &cobra.Command{
+	Use:    "inspect",
+	Short:  "Show the certificates in a secret and whether webhooks, CRDs and APIServices carry its ca",
+	Long:   "Show the ca and certificate stored in secret 'secret-name' in 'namespace' and check whether the named webhooks, CustomResourceDefinitions and APIServices carry that exact ca in their caBundle",
+	PreRun: configureReportLogging,
+	RunE:   inspectCommand,
+}
+
+type inspectReport struct {
+	Secret    string           `json:"secret"`
+	CA        []certs.Info     `json:"ca"`
+	Cert      []certs.Info     `json:"cert,omitempty"`
+	CABundles []caBundleStatus `json:"caBundles"`
+
+	certificate *config.Certificate
+}
+
+type caBundleStatus struct {
+	k8s.CABundle
+	Matches bool `json:"matches"`
+}
+
+// configureReportLogging configures logging for commands that print a report, keeping stdout free of log lines.
+func configureReportLogging(cmd *cobra.Command, args []string) {
+	configureLogging(cmd, args)
+	log.SetOutput(os.Stderr)
+}
+
+func inspectCommand(cmd *cobra.Command, _ []string) error {
+	if cfg.output != "json" && cfg.output != "table" {
+		return errors.Errorf("invalid output format '%s'", cfg.output)
+	}
+	certificates, err := certificates(cmd)
+	if err != nil {
+		return err
+	}
+	k, err := newKubernetes(cfg.kubeconfig)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := operationContext(cmd)
+	defer cancel()
+
+	for i := range certificates {
+		c := &certificates[i]
+		secret, err := k.GetCerts(ctx, secretRef(c))
+		if err != nil {
+			return err
+		}
+		if secret == nil || secret.CA == nil {
+			return errors.Errorf("no secret with '%s' in '%s'", c.SecretName, c.Namespace)
+		}
+
+		report, err := newInspectReport(ctx, k, c, secret.CA, secret.Cert)
+		if err != nil {
+			return err
+		}
+
+		if cfg.output == "json" {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			err = enc.Encode(report)
+		} else {
+			if i > 0 {
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			err = printInspectReport(cmd.OutOrStdout(), report)
+		}
+		if err != nil {
+			return errors.Wrap(err, "error writing report")
+		}
+	}
+	return nil
+}
+
+func newInspectReport(ctx context.Context, k k8s.CABundlePatcher, c *config.Certificate, ca, cert []byte) (*inspectReport, error) {
+	report := &inspectReport{Secret: c.Namespace + "/" + c.SecretName, certificate: c}
+
+	caCerts, err := certs.ParseCertificates(ca)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid '%s' in secret %s", c.CAName, report.Secret)
+	}
+	for _, caCert := range caCerts {
+		report.CA = append(report.CA, certs.Describe(caCert))
+	}
+
+	if cert != nil {
+		leafCerts, err := certs.ParseCertificates(cert)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid '%s' in secret %s", c.CertName, report.Secret)
+		}
+		for _, leafCert := range leafCerts {
+			report.Cert = append(report.Cert, certs.Describe(leafCert))
+		}
+	}
+
+	bundles, err := k.GetCABundles(ctx, patchOptions(&c.Patch))
+	if err != nil {
+		return nil, err
+	}
+	want, err := caBundle(ca, &c.Patch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid '%s' in secret %s", c.CAName, report.Secret)
+	}
+	for _, b := range bundles {
+		report.CABundles = append(report.CABundles, caBundleStatus{CABundle: b, Matches: bytes.Equal(b.CABundle, want)})
+	}
+
+	return report, nil
+}
+
+func printInspectReport(out io.Writer, report *inspectReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Secret:\t%s\n", report.Secret)
+	for _, info := range report.CA {
+		printCertificateInfo(w, report.certificate.CAName, info)
+	}
+	for _, info := range report.Cert {
+		printCertificateInfo(w, report.certificate.CertName, info)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "error writing report")
+	}
+
+	if len(report.CABundles) == 0 {
+		return nil
+	}
+
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "KIND\tNAME\tWEBHOOK\tCA")
+	for _, b := range report.CABundles {
+		status := "match"
+		if !b.Matches {
+			status = "mismatch"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", b.Kind, b.Name, b.Webhook, status)
+	}
+	return errors.Wrap(w.Flush(), "error writing report")
+}
+
+func printCertificateInfo(w io.Writer, name string, info certs.Info) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Certificate:\t%s\n", name)
+	fmt.Fprintf(w, "  Subject:\t%s\n", info.Subject)
+	fmt.Fprintf(w, "  Issuer:\t%s\n", info.Issuer)
+	fmt.Fprintf(w, "  Serial number:\t%s\n", info.SerialNumber)
+	fmt.Fprintf(w, "  CA:\t%t\n", info.IsCA)
+	fmt.Fprintf(w, "  SANs:\t%s\n", strings.Join(append(append(append([]string{}, info.DNSNames...), info.IPAddresses...), info.URIs...), ", "))
+	fmt.Fprintf(w, "  Key type:\t%s\n", info.KeyType)
+	fmt.Fprintf(w, "  SHA-1 fingerprint:\t%s\n", info.SHA1Fingerprint)
+	fmt.Fprintf(w, "  SHA-256 fingerprint:\t%s\n", info.SHA256Fingerprint)
+	fmt.Fprintf(w, "  Not before:\t%s\n", info.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(w, "  Not after:\t%s\n", info.NotAfter.Format(time.RFC3339))
+}
+
+func init() {
+	rootCmd.AddCommand(inspect)
+	inspect.Flags().StringVar(&cfg.secretName, "secret-name", "", "Name of the secret where certificate information will be read from")
+	inspect.Flags().StringVar(&cfg.namespace, "namespace", "", "Namespace of the secret where certificate information will be read from")
+	inspect.Flags().StringVar(&cfg.caName, "ca-name", "ca.crt", "Name of ca file in the secret")
+	inspect.Flags().StringVar(&cfg.certName, "cert-name", "", certNameUsage)
+	inspect.Flags().StringVar(&cfg.webhookName, "webhook-name", "", "Name of ValidatingWebhookConfiguration and MutatingWebhookConfiguration to check")
+	inspect.Flags().BoolVar(&cfg.patchValidating, "validating", true, "If true, check ValidatingWebhookConfiguration")
+	inspect.Flags().BoolVar(&cfg.patchMutating, "mutating", true, "If true, check MutatingWebhookConfiguration")
+	inspect.Flags().StringVar(&cfg.admissionRegistrationVersion, "admission-registration-version", "v1", "admissionregistration.k8s.io api version")
+	inspect.Flags().StringVar(&cfg.crds, "crds", "", "Comma-separated CustomResourceDefinition names whose conversion webhook caBundle to check")
+	inspect.Flags().StringVar(&cfg.crdAPIGroups, "crd-api-groups", "", "Comma-separated CustomResourceDefinition API Groups whose conversion webhook caBundle to check")
+	inspect.Flags().StringVar(&cfg.apiServices, "apiservices", "", "Comma-separated APIService names whose caBundle to check")
+	addCABundleFlag(inspect)
+	inspect.Flags().StringVarP(&cfg.output, "output", "o", "table", "Output format: table|json")
+}
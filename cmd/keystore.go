@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+// withExtraData returns opts plus the keys that c adds to its secret holding generated: the keystore, truststore
+// and encrypted key.
+func withExtraData(ctx context.Context, k k8s.SecretStore, c *config.Certificate, generated *k8s.Certs, opts []k8s.SecretOption) ([]k8s.SecretOption, error) {
+	if c.Keystore == nil && c.EncryptedKey == nil {
+		return opts, nil
+	}
+	existing, err := k.GetSecretData(ctx, c.Namespace, c.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := extraData(ctx, k, c, generated, existing)
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, k8s.WithData(data)), nil
+}
+
+// ensureExtraData adds the keys that c adds to its secret holding existing when any of them is missing, e.g.
+// because they were enabled after the certificates were generated.
+func ensureExtraData(ctx context.Context, k k8s.SecretStore, c *config.Certificate, existing *k8s.Certs) error {
+	if c.Keystore == nil && c.EncryptedKey == nil {
+		return nil
+	}
+	data, err := k.GetSecretData(ctx, c.Namespace, c.SecretName)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, key := range extraKeys(c) {
+		if data[key] == nil {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	log.Infof("adding '%s' to secret %s", strings.Join(missing, "', '"), secretRef(c))
+	extra, err := extraData(ctx, k, c, existing, data)
+	if err != nil {
+		return err
+	}
+	return k.SaveCerts(ctx, secretRef(c), existing, existing, k8s.WithData(extra))
+}
+
+// extraKeys returns the keys that c adds to its secret besides the ca, cert and key.
+func extraKeys(c *config.Certificate) []string {
+	var keys []string
+	if ks := c.Keystore; ks != nil {
+		keys = append(keys, ks.Name)
+		if ks.TruststoreName != "" {
+			keys = append(keys, ks.TruststoreName)
+		}
+	}
+	if c.EncryptedKey != nil {
+		keys = append(keys, c.EncryptedKey.Name)
+	}
+	return keys
+}
+
+// extraData returns the keys that c adds to its secret holding generated, whose data is existing.
+func extraData(ctx context.Context, k k8s.SecretStore, c *config.Certificate, generated *k8s.Certs, existing map[string][]byte) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	if c.Keystore != nil {
+		keystore, err := keystoreData(ctx, k, c, generated, existing)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range keystore {
+			data[key] = value
+		}
+	}
+	if e := c.EncryptedKey; e != nil {
+		passphrase, err := keyPassphrase(ctx, k, c)
+		if err != nil {
+			return nil, err
+		}
+		if data[e.Name], err = certs.EncryptKey(generated.Key, passphrase); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// keyPassphrase reads the passphrase of the encrypted key of c from its secret or file.
+func keyPassphrase(ctx context.Context, k k8s.SecretStore, c *config.Certificate) (string, error) {
+	e := c.EncryptedKey
+	if e.PassphraseSecret != nil {
+		return secretValue(ctx, k, c.Namespace, e.PassphraseSecret, "key passphrase")
+	}
+	passphrase, err := os.ReadFile(e.PassphraseFile)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading key passphrase")
+	}
+	return strings.TrimRight(string(passphrase), "\r\n"), nil
+}
+
+// secretValue reads the non-empty value of ref, which is described by what in errors.
+func secretValue(ctx context.Context, k k8s.SecretStore, namespace string, ref *config.SecretKey, what string) (string, error) {
+	data, err := k.GetSecretData(ctx, namespace, ref.Name)
+	if err != nil {
+		return "", err
+	}
+	if len(data[ref.Key]) == 0 {
+		return "", errors.Errorf("secret %s/%s has no %s in '%s'", namespace, ref.Name, what, ref.Key)
+	}
+	return string(data[ref.Key]), nil
+}
+
+// keystoreData returns the keystore and truststore of generated for the secret of c, whose data is existing. A
+// generated password is included unless the secret already stores one.
+func keystoreData(ctx context.Context, k k8s.SecretStore, c *config.Certificate, generated *k8s.Certs, existing map[string][]byte) (map[string][]byte, error) {
+	ks := c.Keystore
+	data := map[string][]byte{}
+	password, err := keystorePassword(ctx, k, c, existing)
+	if err != nil {
+		return nil, err
+	}
+	if ks.PasswordSecret == nil && existing[ks.PasswordName] == nil {
+		data[ks.PasswordName] = []byte(password)
+	}
+
+	if data[ks.Name], err = certs.EncodePKCS12(generated.Cert, generated.Key, generated.CA, password); err != nil {
+		return nil, err
+	}
+	if ks.TruststoreName != "" {
+		encode := certs.EncodePKCS12Truststore
+		if ks.TruststoreFormat == config.TruststoreFormatJKS {
+			encode = certs.EncodeJKSTruststore
+		}
+		if data[ks.TruststoreName], err = encode(generated.CA, password); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// keystorePassword reads the password of the keystore of c from its password secret, or else from the secret of c,
+// whose data is existing, or else generates one.
+func keystorePassword(ctx context.Context, k k8s.SecretStore, c *config.Certificate, existing map[string][]byte) (string, error) {
+	ks := c.Keystore
+	if ks.PasswordSecret != nil {
+		return secretValue(ctx, k, c.Namespace, ks.PasswordSecret, "keystore password")
+	}
+	if password := existing[ks.PasswordName]; len(password) != 0 {
+		return string(password), nil
+	}
+
+	password := make([]byte, 24)
+	if _, err := rand.Read(password); err != nil {
+		return "", errors.Wrap(err, "failed to generate keystore password")
+	}
+	return base64.RawURLEncoding.EncodeToString(password), nil
+}
+
+// addKeystoreFlags adds the flags storing the certificates as a PKCS #12 keystore and a truststore.
+func addKeystoreFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.keystoreName, "keystore-name", "", "If set, also store the cert, its chain and key as a PKCS #12 keystore under this key of the secret: e.g. keystore.p12")
+	cmd.Flags().StringVar(&cfg.truststoreName, "truststore-name", "", "If set, also store the ca as a truststore under this key of the secret: e.g. truststore.p12")
+	cmd.Flags().StringVar(&cfg.truststoreFormat, "truststore-format", config.TruststoreFormatPKCS12, "Format of the truststore: pkcs12|jks, where jks can be read by every Java version")
+	cmd.Flags().StringVar(&cfg.keystorePasswordSecret, "keystore-password-secret", "", "Secret in 'namespace' holding the password of the keystore and truststore. Defaults to a password generated into the secret")
+	cmd.Flags().StringVar(&cfg.keystorePasswordKey, "keystore-password-key", "password", "Key of the password in 'keystore-password-secret'")
+	cmd.Flags().StringVar(&cfg.keystorePasswordName, "keystore-password-name", "", "Key of the generated password in the secret. Defaults to keystore.password")
+}
+
+// addEncryptedKeyFlags adds the flags storing the key encrypted with a passphrase.
+func addEncryptedKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cfg.encryptedKeyName, "encrypted-key-name", "", "Key of the encrypted key in the secret. Defaults to 'key-name' with a .enc suffix")
+	cmd.Flags().StringVar(&cfg.keyPassphraseSecret, "key-passphrase-secret", "", "If set, also store the key PKCS #8 encrypted with the passphrase in this secret in 'namespace'")
+	cmd.Flags().StringVar(&cfg.keyPassphraseKey, "key-passphrase-key", "passphrase", "Key of the passphrase in 'key-passphrase-secret'")
+	cmd.Flags().StringVar(&cfg.keyPassphraseFile, "key-passphrase-file", "", "If set, also store the key PKCS #8 encrypted with the passphrase in this file")
+}
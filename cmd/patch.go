@@ -1,102 +1,83 @@
 package cmd
 
 import (
-	"context"
-	"os"
-
 	"github.com/pkg/errors"
-	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	apiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
-	aggregator "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
 
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
 	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
 )
 
 var patch = &cobra.Command{
 	Use:    "patch",
-	Short:  "Patch a ValidatingWebhookConfiguration, MutatingWebhookConfiguration and CustomResourceDefinition",
-	Long:   "Patch a ValidatingWebhookConfiguration and MutatingWebhookConfiguration 'webhook-name' and CustomResourceDefinitions by using the ca from 'secret-name' in 'namespace'",
-	PreRun: prePatchCommand,
-	RunE:   patchCommand,
+	Short:  "Patch a ValidatingWebhookConfiguration, MutatingWebhookConfiguration, CustomResourceDefinition and APIService",
+	Long:   "Patch a ValidatingWebhookConfiguration and MutatingWebhookConfiguration 'webhook-name', CustomResourceDefinitions and APIServices by using the ca from 'secret-name' in 'namespace'",
+	PreRun: configureLogging,
+	RunE:   instrument("patch", patchCommand),
 }
 
-func prePatchCommand(cmd *cobra.Command, args []string) {
-	configureLogging(cmd, args)
-	if cfg.patchMutating == false && cfg.patchValidating == false {
-		log.Fatal("patch-validating=false, patch-mutating=false. You must patch at least one kind of webhook, otherwise this command is a no-op")
-		os.Exit(1)
-	}
-	switch cfg.patchFailurePolicy {
-	case "":
-		break
-	case "Ignore":
-	case "Fail":
-		failurePolicy = cfg.patchFailurePolicy
-	default:
-		log.Fatalf("patch-failure-policy %s is not valid", cfg.patchFailurePolicy)
-		os.Exit(1)
-	}
-}
-
-func patchCommand(_ *cobra.Command, _ []string) error {
-	k, err := k8s.New(newKubernetesClients(cfg.kubeconfig))
+func patchCommand(cmd *cobra.Command, _ []string) error {
+	conf, err := patchConfig(cmd)
 	if err != nil {
 		return err
 	}
-	ca, err := k.GetCaFromSecret(cfg.secretName, cfg.namespace, cfg.caName)
+	k, err := newKubernetes(cfg.kubeconfig)
 	if err != nil {
 		return err
 	}
+	ctx, cancel := operationContext(cmd)
+	defer cancel()
 
-	if ca == nil {
-		return errors.Errorf("no secret with '%s' in '%s'", cfg.secretName, cfg.namespace)
-	}
-
-	ctx := context.Background()
-
-	if err := k.PatchWebhookConfigurations(
-		ctx,
-		cfg.webhookName,
-		ca,
-		failurePolicy,
-		cfg.patchMutating,
-		cfg.patchValidating,
-		k8s.AdmissionRegistrationVersion(cfg.admissionRegistrationVersion),
-	); err != nil {
-		return err
-	}
+	for i := range conf.Certificates {
+		c := &conf.Certificates[i]
+		if c.Patch.Empty() {
+			continue
+		}
+		secret, err := k.GetCerts(ctx, secretRef(c))
+		if err != nil {
+			return err
+		}
+		if secret == nil {
+			return errors.Errorf("no secret with '%s' in '%s'", c.SecretName, c.Namespace)
+		}
+		if secret.CA == nil {
+			return errors.Wrapf(k8s.ErrMalformedSecret, "secret %s/%s does not contain '%s' key", c.Namespace, c.SecretName, c.CAName)
+		}
+		observeCertificate(c, secret)
 
-	if cfg.crds != "" || cfg.crdAPIGroups != "" {
-		if err := k.PatchCustomResourceDefinitions(ctx, cfg.crds, cfg.crdAPIGroups, ca); err != nil {
+		bundle, err := caBundle(secret.CA, &c.Patch)
+		if err != nil {
+			return errors.Wrapf(err, "invalid '%s' in secret %s/%s", c.CAName, c.Namespace, c.SecretName)
+		}
+		if err := k.PatchCABundles(ctx, bundle, patchOptions(&c.Patch)); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
-func newKubernetesClients(kubeconfig string) (kubernetes.Interface, aggregator.Interface, apiextensions.Interface) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// patchConfig returns the validated config and fails when none of its certificates has anything to patch.
+func patchConfig(cmd *cobra.Command) (*config.Config, error) {
+	c, err := validConfig(cmd)
 	if err != nil {
-		log.WithError(err).Fatal("error building kubernetes config")
+		return nil, err
 	}
-
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		log.WithError(err).Fatal("error creating kubernetes client")
+	for i := range c.Certificates {
+		if !c.Certificates[i].Patch.Empty() {
+			return c, nil
+		}
 	}
+	return nil, errors.New("nothing to patch: set webhook-name, crds, crd-api-groups or apiservices")
+}
 
-	aggregatorClientset, err := aggregator.NewForConfig(config)
+// newKubernetes returns a K8s for the kubeconfig file, or for the in-cluster config when kubeconfig is empty.
+func newKubernetes(kubeconfig string) (k8s.Interface, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
-		log.WithError(err).Fatal("error creating kubernetes aggregator client")
+		return nil, errors.Wrap(err, "error building kubernetes config")
 	}
-
-	apiextensionClientset, err := apiextensions.NewForConfig(config)
-
-	return clientset, aggregatorClientset, apiextensionClientset
+	return k8s.NewForConfig(config)
 }
 
 func init() {
@@ -110,7 +91,6 @@ func init() {
 	patch.Flags().StringVar(&cfg.admissionRegistrationVersion, "admission-registration-version", "v1", "admissionregistration.k8s.io api version")
 	patch.Flags().StringVar(&cfg.crds, "crds", "", "Comma-separated CustomResourceDefinition names for which to patch the conversion webhook caBundle")
 	patch.Flags().StringVar(&cfg.crdAPIGroups, "crd-api-groups", "", "Comma-separated CustomResourceDefinition API Groups for which to patch the conversion webhook caBundle")
-	_ = patch.MarkFlagRequired("secret-name")
-	_ = patch.MarkFlagRequired("namespace")
-	_ = patch.MarkFlagRequired("webhook-name")
+	patch.Flags().StringVar(&cfg.apiServices, "apiservices", "", "Comma-separated APIService names for which to patch the caBundle")
+	addCABundleFlag(patch)
 }
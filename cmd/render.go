@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/manifest"
+)
+
+var render = &cobra.Command{
+	Use:   "render",
+	Short: "Write a secret manifest and the given manifests with their caBundle filled in, without using the Kubernetes API",
+	Long: `Read ValidatingWebhookConfiguration, MutatingWebhookConfiguration, CustomResourceDefinition and APIService manifests
+from 'filename' or stdin, generate certificates for 'host' or load them from 'certs-dir', and write a secret
+'secret-name' manifest followed by every input manifest, with the caBundle of the selected objects set to the ca.
+Other manifests are written unchanged, so the command can be used as a Helm post-renderer.
+
+Without 'certs-dir' or 'signer-cert-file', every run generates a new ca, so applying the output again rotates the ca:
+the caBundles change at once while running pods keep serving certificates of the previous ca until they restart.
+Set 'certs-dir' to render the same certificates on every run.`,
+	PreRun: configureReportLogging,
+	RunE:   renderCommand,
+}
+
+func renderCommand(cmd *cobra.Command, _ []string) error {
+	c, err := loadConfig(cmd, "")
+	if err != nil {
+		return err
+	}
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	if cfg.certsDir != "" && len(c.Certificates) > 1 {
+		return errors.New("certs-dir supports a single certificate")
+	}
+
+	objs, err := readManifests(cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+
+	var shared *certs.CA
+	if c.SharedCA && cfg.certsDir == "" {
+		if shared, err = newSharedSigner(c.Certificates); err != nil {
+			return err
+		}
+	}
+
+	var secrets []*unstructured.Unstructured
+	for i := range c.Certificates {
+		secret, err := renderCertificate(&c.Certificates[i], shared, objs, len(c.Certificates) > 1 && shared == nil)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return manifest.Encode(cmd.OutOrStdout(), append(secrets, objs...))
+}
+
+// renderCertificate returns the secret manifest of the certificate and injects its ca into the objects selected by
+// its patch targets. Without patch targets, every supported object is injected, unless there are several
+// certificates with different cas. A shared ca, if not nil, signs the certificate.
+func renderCertificate(c *config.Certificate, shared *certs.CA, objs []*unstructured.Unstructured, several bool) (*unstructured.Unstructured, error) {
+	ca, cert, key, err := renderCerts(c, shared)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := manifest.Secret(k8s.NewSecret(c.SecretName, c.Namespace, map[string][]byte{
+		c.CAName:   ca,
+		c.CertName: cert,
+		c.KeyName:  key,
+	}, secretOptions(c)...))
+	if err != nil {
+		return nil, err
+	}
+
+	if several && c.Patch.Empty() {
+		return secret, nil
+	}
+	selector := manifest.Selector{
+		CRDs:         c.Patch.CRDs,
+		CRDAPIGroups: c.Patch.CRDAPIGroups,
+		APIServices:  c.Patch.APIServices,
+	}
+	if c.Patch.WebhookName != "" {
+		selector.WebhookNames = []string{c.Patch.WebhookName}
+	}
+	bundle, err := caBundle(ca, &c.Patch)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		injected, err := manifest.InjectCABundle(obj, bundle, selector)
+		if err != nil {
+			return nil, err
+		}
+		if injected {
+			log.Infof("injected caBundle of secret %s into %s %s", c.SecretName, obj.GetKind(), obj.GetName())
+		}
+	}
+	return secret, nil
+}
+
+// readManifests decodes the manifests of every file given with --filename, reading stdin for "-" or when none is given.
+func readManifests(stdin io.Reader) ([]*unstructured.Unstructured, error) {
+	filenames := cfg.filenames
+	if len(filenames) == 0 {
+		filenames = []string{"-"}
+	}
+
+	var objs []*unstructured.Unstructured
+	for _, filename := range filenames {
+		decoded, err := decodeManifestFile(filename, stdin)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filename)
+		}
+		objs = append(objs, decoded...)
+	}
+	return objs, nil
+}
+
+func decodeManifestFile(filename string, stdin io.Reader) ([]*unstructured.Unstructured, error) {
+	if filename == "-" {
+		return manifest.Decode(stdin)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening file")
+	}
+	defer f.Close()
+	return manifest.Decode(f)
+}
+
+// renderCerts loads the certificates from --certs-dir, or generates them with the shared ca, if not nil, when it is
+// not set.
+func renderCerts(c *config.Certificate, shared *certs.CA) (ca, cert, key []byte, err error) {
+	if c.Client != nil {
+		return nil, nil, nil, errors.Errorf("client certificates are not supported by render, for secret %s", c.SecretName)
+	}
+	if c.Keystore != nil || c.EncryptedKey != nil {
+		return nil, nil, nil, errors.Errorf("keystores and encrypted keys are not supported by render, for secret %s", c.SecretName)
+	}
+	if cfg.certsDir == "" {
+		if len(c.Hosts) == 0 {
+			return nil, nil, nil, errors.Errorf("either hosts or certs-dir is required for secret %s", c.SecretName)
+		}
+		var generated *k8s.Certs
+		if shared != nil {
+			generated, _, err = issueCerts(shared, c)
+		} else {
+			generated, _, err = generateCerts(c)
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return generated.CA, generated.Cert, generated.Key, nil
+	}
+
+	files := certs.Files{Dir: cfg.certsDir, CAName: cfg.caFile, CertName: cfg.certFile, KeyName: cfg.keyFile}
+	ca, cert, key, err = files.Read()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ca == nil {
+		return nil, nil, nil, errors.Errorf("no certificates in %s", cfg.certsDir)
+	}
+	return ca, cert, key, nil
+}
+
+func init() {
+	rootCmd.AddCommand(render)
+	render.Flags().StringArrayVarP(&cfg.filenames, "filename", "f", nil, "Manifest file to read, may be repeated. Reads stdin when '-' or not set")
+	render.Flags().StringVar(&cfg.host, "host", "", "Comma-separated DNS names, IPs and URIs to generate a certificate for: e.g. webhook.{{ .Namespace }}.svc,spiffe://${TRUST_DOMAIN}/ns/default")
+	addClusterDomainFlag(render)
+	render.Flags().StringVar(&cfg.certsDir, "certs-dir", "", "If set, load the certificates from this directory instead of generating them")
+	render.Flags().StringVar(&cfg.caFile, "ca-file", "ca.crt", "Name of ca file in the certs directory")
+	render.Flags().StringVar(&cfg.certFile, "cert-file", "tls.crt", "Name of cert file in the certs directory")
+	render.Flags().StringVar(&cfg.keyFile, "key-file", "tls.key", "Name of key file in the certs directory")
+	render.Flags().StringVar(&cfg.secretName, "secret-name", "", "Name of the secret manifest where certificate information will be written")
+	render.Flags().StringVar(&cfg.namespace, "namespace", "", "Namespace of the secret manifest where certificate information will be written")
+	render.Flags().StringVar(&cfg.caName, "ca-name", "ca.crt", "Name of ca file in the secret")
+	render.Flags().StringVar(&cfg.certName, "cert-name", "", certNameUsage)
+	render.Flags().StringVar(&cfg.keyName, "key-name", "", keyNameUsage)
+	addSecretFlags(render)
+	addCertificateFlag(render)
+	addProfileFlags(render)
+	render.Flags().StringVar(&cfg.webhookName, "webhook-name", "", "If set, only inject ValidatingWebhookConfigurations and MutatingWebhookConfigurations with this name")
+	render.Flags().StringVar(&cfg.crds, "crds", "", "If set, only inject these comma-separated CustomResourceDefinition names")
+	render.Flags().StringVar(&cfg.crdAPIGroups, "crd-api-groups", "", "If set, only inject CustomResourceDefinitions of these comma-separated API Groups")
+	render.Flags().StringVar(&cfg.apiServices, "apiservices", "", "If set, only inject these comma-separated APIService names")
+	addCABundleFlag(render)
+}
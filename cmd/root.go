@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/onrik/logrus/filename"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -14,8 +19,9 @@ var (
 		Short: "Create certificates and patch them to admission hooks",
 		Long: `Use this to create a ca and signed certificates and patch admission webhooks to allow for quick
 	           installation and configuration of validating and admission webhooks.`,
-		PreRun: configureLogging,
-		Run:    rootCommand,
+		PersistentPreRunE: persistentPreRun,
+		PreRun:            configureLogging,
+		Run:               rootCommand,
 	}
 
 	cfg = struct {
@@ -29,24 +35,101 @@ var (
 		host                         string
 		crds                         string
 		crdAPIGroups                 string
+		apiServices                  string
 		webhookName                  string
 		admissionRegistrationVersion string
 		patchValidating              bool
 		patchMutating                bool
 		patchFailurePolicy           string
 		kubeconfig                   string
+		listenAddress                string
+		interval                     time.Duration
+		pushgatewayURL               string
+		output                       string
+		expiryThreshold              time.Duration
+		outputDir                    string
+		caFile                       string
+		certFile                     string
+		keyFile                      string
+		certFileMode                 string
+		keyFileMode                  string
+		certsDir                     string
+		filenames                    []string
+		configFile                   string
+		secretType                   string
+		secretLabels                 map[string]string
+		secretAnnotations            map[string]string
+		ownerReference               map[string]string
+		lock                         bool
+		lockTimeout                  time.Duration
+		timeout                      time.Duration
+		caNameConstraints            bool
+		caCommonName                 string
+		caOrganization               string
+		caOrganizationalUnit         string
+		commonName                   string
+		organization                 string
+		organizationalUnit           string
+		intermediateCA               bool
+		signerCertFile               string
+		signerKeyFile                string
+		caBundle                     string
+		clientSecretName             string
+		clientCommonName             string
+		clientOrganization           string
+		clientCertFile               string
+		clientKeyFile                string
+		keystoreName                 string
+		truststoreName               string
+		truststoreFormat             string
+		keystorePasswordSecret       string
+		keystorePasswordKey          string
+		keystorePasswordName         string
+		encryptedKeyName             string
+		keyPassphraseSecret          string
+		keyPassphraseKey             string
+		keyPassphraseFile            string
+		certificates                 []string
+		clusterDomain                string
 	}{}
-
-	failurePolicy string
 )
 
-// Execute is the main entry point for the program.
+// exitCodeError makes the program exit with a specific code instead of 1.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+// Execute is the main entry point for the program. Commands are cancelled on SIGINT and SIGTERM.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		os.Exit(exitError)
 	}
 }
 
+// operationContext returns the context for the Kubernetes API calls of cmd, which ends after --timeout if set.
+func operationContext(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if cfg.timeout > 0 {
+		return context.WithTimeout(cmd.Context(), cfg.timeout)
+	}
+	return context.WithCancel(cmd.Context())
+}
+
 func init() {
 	filenameHook := filename.NewHook()
 	filenameHook.Field = "source"
@@ -57,7 +140,20 @@ func init() {
 	create.Flags().StringVar(&cfg.caName, "ca-name", "ca.crt", "Name of ca file in the secret")
 	rootCmd.PersistentFlags().StringVar(&cfg.logLevel, "log-level", "info", "Log level: panic|fatal|error|warn|info|debug|trace")
 	rootCmd.PersistentFlags().StringVar(&cfg.logfmt, "log-format", "json", "Log format: text|json")
+	rootCmd.PersistentFlags().StringVar(&cfg.configFile, "config", "", "Path to a YAML or JSON config file listing certificates and their patch targets. Flags that are set override its values")
+	rootCmd.PersistentFlags().DurationVar(&cfg.timeout, "timeout", 0, "If set, cancel the Kubernetes API calls of a command after this duration: e.g. 2m")
 	rootCmd.PersistentFlags().StringVar(&cfg.kubeconfig, "kubeconfig", "", "Path to kubeconfig file: e.g. ~/.kube/kind-config-kind")
+	rootCmd.PersistentFlags().StringVar(&cfg.listenAddress, "listen-address", "", "Address on which to serve /metrics, /healthz and /readyz while running: e.g. :8080. Disabled when empty")
+	rootCmd.PersistentFlags().StringVar(&cfg.pushgatewayURL, "pushgateway-url", "", "If set, push metrics to this Pushgateway-compatible endpoint when a command completes")
+}
+
+// persistentPreRun runs before every command: it sets flags from the environment and starts the HTTP server.
+func persistentPreRun(cmd *cobra.Command, args []string) error {
+	if err := bindEnv(cmd); err != nil {
+		return err
+	}
+	startServer(cmd, args)
+	return nil
 }
 
 func configureLogging(_ *cobra.Command, _ []string) {
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/health"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+var run = &cobra.Command{
+	Use:    "run",
+	Short:  "Create the secret if needed, then patch the webhooks, CustomResourceDefinitions and APIServices with its ca",
+	Long:   "Generate a ca and server cert+key into secret 'secret-name' in 'namespace' unless it already holds them, then patch ValidatingWebhookConfiguration and MutatingWebhookConfiguration 'webhook-name', CustomResourceDefinitions and APIServices with the ca of the secret",
+	PreRun: configureLogging,
+	RunE:   runCommand,
+}
+
+func runCommand(cmd *cobra.Command, args []string) error {
+	reconcile := instrument("run", reconcileCommand)
+	if cfg.interval <= 0 {
+		return reconcile(cmd, args)
+	}
+
+	k, err := newKubernetes(cfg.kubeconfig)
+	if err != nil {
+		return err
+	}
+	probes.AddReadinessCheck("apiserver", apiServerCheck(k))
+	// A reconcile may wait for the lock and then for its API calls, so the loop is only considered stuck when it
+	// missed several intervals on top of that.
+	heartbeat := health.NewHeartbeat(3*cfg.interval + cfg.lockTimeout + cfg.timeout)
+	probes.AddLivenessCheck("reconcile-loop", heartbeat.Check)
+
+	// The root command cancels the context on SIGINT and SIGTERM.
+	return reconcileEvery(cmd.Context(), cfg.interval, func() error {
+		defer heartbeat.Beat()
+		return reconcile(cmd, args)
+	})
+}
+
+// apiServerCheck returns a readiness check that fails while the API server cannot be reached.
+func apiServerCheck(k k8s.Pinger) health.Checker {
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+		defer cancel()
+		return k.Ping(ctx)
+	}
+}
+
+// reconcileEvery calls reconcile right away and then at every interval until ctx is done, which lets a running
+// reconcile finish. Failed reconciles are logged and retried at the next interval, while the readiness probe
+// reports them.
+func reconcileEvery(ctx context.Context, interval time.Duration, reconcile func() error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := reconcile(); err != nil {
+			log.WithError(err).Errorf("reconcile failed, retrying in %s", interval)
+		}
+		select {
+		case <-ctx.Done():
+			log.Info("stopping")
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcileCommand creates the secrets if needed and patches their ca once.
+func reconcileCommand(cmd *cobra.Command, _ []string) error {
+	conf, err := patchConfig(cmd)
+	if err != nil {
+		return err
+	}
+	k, err := newKubernetes(cfg.kubeconfig)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := operationContext(cmd)
+	defer cancel()
+
+	cas, err := ensureSecrets(ctx, k, conf)
+	if err != nil {
+		return err
+	}
+	for i := range conf.Certificates {
+		c := &conf.Certificates[i]
+		if c.Patch.Empty() {
+			continue
+		}
+		bundle, err := caBundle(cas[i], &c.Patch)
+		if err != nil {
+			return errors.Wrapf(err, "invalid '%s' in secret %s/%s", c.CAName, c.Namespace, c.SecretName)
+		}
+		if err := k.PatchCABundles(ctx, bundle, patchOptions(&c.Patch)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(run)
+	run.Flags().StringVar(&cfg.host, "host", "", "Comma-separated DNS names, IPs and URIs to generate a certificate for: e.g. webhook.{{ .Namespace }}.svc,spiffe://${TRUST_DOMAIN}/ns/default")
+	addClusterDomainFlag(run)
+	run.Flags().StringVar(&cfg.secretName, "secret-name", "", "Name of the secret where certificate information will be written and read from")
+	run.Flags().StringVar(&cfg.namespace, "namespace", "", "Namespace of the secret where certificate information will be written and read from")
+	run.Flags().StringVar(&cfg.caName, "ca-name", "ca.crt", "Name of ca file in the secret")
+	run.Flags().StringVar(&cfg.certName, "cert-name", "", certNameUsage)
+	run.Flags().StringVar(&cfg.keyName, "key-name", "", keyNameUsage)
+	addSecretFlags(run)
+	addCertificateFlag(run)
+	addProfileFlags(run)
+	addClientFlags(run)
+	addKeystoreFlags(run)
+	addEncryptedKeyFlags(run)
+	addLockFlags(run)
+	run.Flags().StringVar(&cfg.webhookName, "webhook-name", "", "Name of ValidatingWebhookConfiguration and MutatingWebhookConfiguration that will be updated")
+	run.Flags().BoolVar(&cfg.patchValidating, "patch-validating", true, "If true, patch ValidatingWebhookConfiguration")
+	run.Flags().BoolVar(&cfg.patchMutating, "patch-mutating", true, "If true, patch MutatingWebhookConfiguration")
+	run.Flags().StringVar(&cfg.patchFailurePolicy, "patch-failure-policy", "", "If set, patch the webhooks with this failure policy. Valid options are Ignore or Fail")
+	run.Flags().StringVar(&cfg.admissionRegistrationVersion, "admission-registration-version", "v1", "admissionregistration.k8s.io api version")
+	run.Flags().StringVar(&cfg.crds, "crds", "", "Comma-separated CustomResourceDefinition names for which to patch the conversion webhook caBundle")
+	run.Flags().StringVar(&cfg.crdAPIGroups, "crd-api-groups", "", "Comma-separated CustomResourceDefinition API Groups for which to patch the conversion webhook caBundle")
+	run.Flags().StringVar(&cfg.apiServices, "apiservices", "", "Comma-separated APIService names for which to patch the caBundle")
+	addCABundleFlag(run)
+	run.Flags().DurationVar(&cfg.interval, "interval", 0, "If set, keep running and reconcile again at this interval, e.g. to serve /readyz from a Deployment. Runs once when 0")
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/health"
+)
+
+func TestReconcileEvery(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := &health.Reconcile{}
+	var calls int
+	err := reconcileEvery(ctx, time.Millisecond, func() error {
+		calls++
+		var err error
+		if calls == 1 {
+			err = errors.New("api server unavailable")
+		}
+		ready.Observe(err)
+		if calls == 1 {
+			assert.Error(t, ready.Check())
+		}
+		if calls == 3 {
+			cancel()
+		}
+		return err
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.NoError(t, ready.Check())
+}
+
+func TestAPIServerCheck(t *testing.T) {
+	t.Parallel()
+
+	k := newFakeK8s()
+	check := apiServerCheck(k)
+	assert.NoError(t, check())
+
+	k.pingErr = errors.New("connection refused")
+	assert.EqualError(t, check(), "connection refused")
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/health"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/metrics"
+)
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	// probeTimeout bounds the API requests of the health probes.
+	probeTimeout = 5 * time.Second
+)
+
+var (
+	probes        = health.New()
+	lastReconcile = &health.Reconcile{}
+)
+
+func init() {
+	probes.AddReadinessCheck("reconcile", lastReconcile.Check)
+}
+
+// startServer starts the HTTP server exposing /metrics, /healthz and /readyz when a listen address
+// is configured.
+func startServer(_ *cobra.Command, _ []string) {
+	if cfg.listenAddress == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", probes.LivenessHandler())
+	mux.Handle("/readyz", probes.ReadinessHandler())
+
+	server := &http.Server{
+		Addr:              cfg.listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	go func() {
+		log.Infof("serving metrics and health probes on %s", cfg.listenAddress)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.WithError(err).Error("error serving metrics and health probes")
+		}
+	}()
+}
+
+// instrument wraps a command so that its duration and result are recorded for metrics and the
+// readiness probe, and pushed to a Pushgateway when one is configured.
+func instrument(command string, run func(*cobra.Command, []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
+		err := run(cmd, args)
+		metrics.ObserveReconcile(command, time.Since(start), err)
+		lastReconcile.Observe(err)
+
+		if cfg.pushgatewayURL != "" {
+			if pushErr := metrics.Push(cfg.pushgatewayURL, "kube-webhook-certgen-"+command); pushErr != nil {
+				log.WithError(pushErr).Warn("error pushing metrics")
+			}
+		}
+		return err
+	}
+}
+
+// observeCertificate records the expiry of the serving certificate and the ca stored in the secret of c. A secret
+// without cert, which patch accepts, only records the ca.
+func observeCertificate(c *config.Certificate, stored *k8s.Certs) {
+	if len(stored.Cert) != 0 {
+		if err := metrics.ObserveCertificate(c.Namespace, c.SecretName, stored.Cert); err != nil {
+			log.WithError(err).Warn("unable to record certificate expiry")
+		}
+	}
+	if err := metrics.ObserveCA(c.Namespace, c.SecretName, stored.CA); err != nil {
+		log.WithError(err).Warn("unable to record ca expiry")
+	}
+}
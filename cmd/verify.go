@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+// Exit codes of the verify command. When several checks fail, the lowest code wins.
+const (
+	exitOK = iota
+	exitError
+	exitSecretMissing
+	exitExpired
+	exitExpiring
+	exitHostMismatch
+	exitChainInvalid
+	exitCABundleDrift
+)
+
+var verify = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the certificates in a secret and the caBundles using them, exiting with a distinct code per failure",
+	Long: `Verify the certificates stored in secret 'secret-name' in 'namespace' and the caBundle of the named webhooks,
+CustomResourceDefinitions and APIServices, print a JSON summary and exit with:
+  0 everything is valid
+  1 verification could not be performed
+  2 the secret does not exist
+  3 the ca or certificate has expired
+  4 the ca or certificate expires within 'expiry-threshold'
+  5 the certificate SANs do not match 'host'
+  6 the certificate does not chain to the ca
+  7 a caBundle does not carry the ca`,
+	PreRun:       configureReportLogging,
+	RunE:         instrument("verify", verifyCommand),
+	SilenceUsage: true,
+}
+
+type verifySummary struct {
+	Secret   string        `json:"secret"`
+	ExitCode int           `json:"exitCode"`
+	Checks   []verifyCheck `json:"checks"`
+}
+
+type verifyCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	ExitCode int    `json:"exitCode"`
+	Message  string `json:"message,omitempty"`
+}
+
+func (s *verifySummary) add(name string, exitCode int, failure string) {
+	s.Checks = append(s.Checks, verifyCheck{Name: name, OK: failure == "", ExitCode: exitCode, Message: failure})
+	if failure != "" && (s.ExitCode == exitOK || exitCode < s.ExitCode) {
+		s.ExitCode = exitCode
+	}
+}
+
+func verifyCommand(cmd *cobra.Command, _ []string) error {
+	certificates, err := certificates(cmd)
+	if err != nil {
+		return err
+	}
+	k, err := newKubernetes(cfg.kubeconfig)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := operationContext(cmd)
+	defer cancel()
+
+	exitCode := exitOK
+	var failed []string
+	for i := range certificates {
+		summary, err := verifyCertificate(ctx, k, &certificates[i])
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(summary); err != nil {
+			return errors.Wrap(err, "error writing summary")
+		}
+
+		if summary.ExitCode == exitOK {
+			continue
+		}
+		if exitCode == exitOK || summary.ExitCode < exitCode {
+			exitCode = summary.ExitCode
+		}
+		for _, c := range summary.Checks {
+			if !c.OK {
+				failed = append(failed, summary.Secret+" "+c.Name)
+			}
+		}
+	}
+
+	if exitCode != exitOK {
+		return &exitCodeError{code: exitCode, err: errors.Errorf("verification failed: %s", strings.Join(failed, ", "))}
+	}
+	return nil
+}
+
+func verifyCertificate(ctx context.Context, k k8s.Interface, c *config.Certificate) (*verifySummary, error) {
+	secret, err := k.GetCerts(ctx, secretRef(c))
+	if err != nil {
+		return nil, err
+	}
+	var ca, cert []byte
+	if secret != nil {
+		ca, cert = secret.CA, secret.Cert
+	}
+
+	summary := &verifySummary{Secret: c.Namespace + "/" + c.SecretName}
+	if ca == nil {
+		summary.add("secret", exitSecretMissing, fmt.Sprintf("secret does not exist or has no '%s' key", c.CAName))
+		return summary, nil
+	}
+	summary.add("secret", exitSecretMissing, "")
+	if err := verifyCertificates(summary, c, ca, cert); err != nil {
+		return nil, err
+	}
+	bundle, err := caBundle(ca, &c.Patch)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid '%s' in secret %s", c.CAName, summary.Secret)
+	}
+	if err := verifyCABundles(ctx, k, summary, &c.Patch, bundle); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+func verifyCertificates(summary *verifySummary, c *config.Certificate, ca, cert []byte) error {
+	caCerts, err := certs.ParseCertificates(ca)
+	if err != nil {
+		return errors.Wrapf(err, "invalid '%s' in secret %s", c.CAName, summary.Secret)
+	}
+	if cert == nil {
+		summary.add("chain", exitChainInvalid, fmt.Sprintf("secret has no '%s' key", c.CertName))
+		verifyExpiry(summary, caCerts[0])
+		return nil
+	}
+	leafCerts, err := certs.ParseCertificates(cert)
+	if err != nil {
+		return errors.Wrapf(err, "invalid '%s' in secret %s", c.CertName, summary.Secret)
+	}
+
+	verifyExpiry(summary, append(caCerts, leafCerts...)...)
+
+	if len(c.Hosts) > 0 {
+		missing, unexpected := certs.CompareHosts(leafCerts[0], strings.Join(c.Hosts, ","))
+		sort.Strings(missing)
+		sort.Strings(unexpected)
+		failure := ""
+		if len(missing) > 0 || len(unexpected) > 0 {
+			failure = fmt.Sprintf("missing SANs [%s], unexpected SANs [%s]", strings.Join(missing, ","), strings.Join(unexpected, ","))
+		}
+		summary.add("hosts", exitHostMismatch, failure)
+	}
+
+	failure := ""
+	if err := certs.VerifyChain(ca, cert); err != nil {
+		failure = err.Error()
+	}
+	summary.add("chain", exitChainInvalid, failure)
+
+	return nil
+}
+
+func verifyExpiry(summary *verifySummary, certificates ...*x509.Certificate) {
+	now := time.Now()
+	var expired, expiring []string
+	for _, c := range certificates {
+		switch {
+		case now.After(c.NotAfter):
+			expired = append(expired, fmt.Sprintf("'%s' expired at %s", c.Subject, c.NotAfter.Format(time.RFC3339)))
+		case now.Add(cfg.expiryThreshold).After(c.NotAfter):
+			expiring = append(expiring, fmt.Sprintf("'%s' expires at %s", c.Subject, c.NotAfter.Format(time.RFC3339)))
+		}
+	}
+	summary.add("expired", exitExpired, strings.Join(expired, "; "))
+	summary.add("expiring", exitExpiring, strings.Join(expiring, "; "))
+}
+
+func verifyCABundles(ctx context.Context, k k8s.CABundlePatcher, summary *verifySummary, p *config.Patch, bundle []byte) error {
+	bundles, err := k.GetCABundles(ctx, patchOptions(p))
+	if err != nil {
+		return err
+	}
+	if len(bundles) == 0 {
+		return nil
+	}
+
+	var drifted []string
+	for _, b := range bundles {
+		if bytes.Equal(b.CABundle, bundle) {
+			continue
+		}
+		name := b.Kind + "/" + b.Name
+		if b.Webhook != "" {
+			name += "/" + b.Webhook
+		}
+		drifted = append(drifted, name)
+	}
+	failure := ""
+	if len(drifted) > 0 {
+		failure = "caBundle does not match ca: " + strings.Join(drifted, ", ")
+	}
+	summary.add("caBundle", exitCABundleDrift, failure)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(verify)
+	verify.Flags().StringVar(&cfg.secretName, "secret-name", "", "Name of the secret where certificate information will be read from")
+	verify.Flags().StringVar(&cfg.namespace, "namespace", "", "Namespace of the secret where certificate information will be read from")
+	verify.Flags().StringVar(&cfg.caName, "ca-name", "ca.crt", "Name of ca file in the secret")
+	verify.Flags().StringVar(&cfg.certName, "cert-name", "", certNameUsage)
+	verify.Flags().StringVar(&cfg.host, "host", "", "If set, comma-separated DNS names, IPs and URIs the certificate SANs must match")
+	addClusterDomainFlag(verify)
+	verify.Flags().DurationVar(&cfg.expiryThreshold, "expiry-threshold", 30*24*time.Hour, "Fail when the ca or certificate expires within this duration")
+	verify.Flags().StringVar(&cfg.webhookName, "webhook-name", "", "Name of ValidatingWebhookConfiguration and MutatingWebhookConfiguration to check")
+	verify.Flags().BoolVar(&cfg.patchValidating, "validating", true, "If true, check ValidatingWebhookConfiguration")
+	verify.Flags().BoolVar(&cfg.patchMutating, "mutating", true, "If true, check MutatingWebhookConfiguration")
+	verify.Flags().StringVar(&cfg.admissionRegistrationVersion, "admission-registration-version", "v1", "admissionregistration.k8s.io api version")
+	verify.Flags().StringVar(&cfg.crds, "crds", "", "Comma-separated CustomResourceDefinition names whose conversion webhook caBundle to check")
+	verify.Flags().StringVar(&cfg.crdAPIGroups, "crd-api-groups", "", "Comma-separated CustomResourceDefinition API Groups whose conversion webhook caBundle to check")
+	verify.Flags().StringVar(&cfg.apiServices, "apiservices", "", "Comma-separated APIService names whose caBundle to check")
+	addCABundleFlag(verify)
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/config"
+	"github.com/kubeshop/kube-webhook-certgen/pkg/k8s"
+)
+
+func TestVerifyCertificate(t *testing.T) {
+	t.Parallel()
+
+	const host = "webhook.default.svc"
+	ca, err := certs.NewCA()
+	assert.NoError(t, err)
+	cert, key, err := ca.Issue(certs.WithHosts(host))
+	assert.NoError(t, err)
+	otherCA, err := certs.NewCA()
+	assert.NoError(t, err)
+	otherCert, _, err := otherCA.Issue(certs.WithHosts(host))
+	assert.NoError(t, err)
+	expiringCert, _, err := ca.Issue(certs.WithHosts(host), certs.WithValidity(24*time.Hour))
+	assert.NoError(t, err)
+	expiredCert, _, err := ca.Issue(certs.WithHosts(host), certs.WithValidity(time.Minute))
+	assert.NoError(t, err)
+	expiredCA, err := certs.NewCA(certs.WithValidity(time.Minute))
+	assert.NoError(t, err)
+	expiredLeaf, expiredKey, err := expiredCA.Issue(certs.WithHosts(host))
+	assert.NoError(t, err)
+
+	bundle := []k8s.CABundle{{Kind: "ValidatingWebhookConfiguration", Name: "webhook", CABundle: ca.Certificate()}}
+	drifted := []k8s.CABundle{{Kind: "ValidatingWebhookConfiguration", Name: "webhook", CABundle: otherCA.Certificate()}}
+
+	for name, tc := range map[string]struct {
+		secret  *k8s.Certs
+		hosts   []string
+		bundles []k8s.CABundle
+		want    int
+		failed  []string
+		// expired is the number of certificates reported by the expired check.
+		expired int
+	}{
+		"valid": {
+			secret:  &k8s.Certs{CA: ca.Certificate(), Cert: cert, Key: key},
+			hosts:   []string{host},
+			bundles: bundle,
+			want:    exitOK,
+		},
+		"no secret": {
+			want:   exitSecretMissing,
+			failed: []string{"secret"},
+		},
+		"no cert key": {
+			secret:  &k8s.Certs{CA: ca.Certificate()},
+			hosts:   []string{host},
+			bundles: bundle,
+			want:    exitChainInvalid,
+			failed:  []string{"chain"},
+		},
+		"no cert key and expired ca": {
+			secret: &k8s.Certs{CA: expiredCA.Certificate()},
+			want:   exitExpired,
+			failed: []string{"chain", "expired"},
+		},
+		"expired ca and cert": {
+			secret:  &k8s.Certs{CA: expiredCA.Certificate(), Cert: expiredLeaf, Key: expiredKey},
+			hosts:   []string{host},
+			want:    exitExpired,
+			failed:  []string{"expired"},
+			expired: 2,
+		},
+		"expiring": {
+			secret:  &k8s.Certs{CA: ca.Certificate(), Cert: expiringCert, Key: key},
+			bundles: bundle,
+			want:    exitExpiring,
+			failed:  []string{"expiring"},
+		},
+		"expired and host mismatch": {
+			secret: &k8s.Certs{CA: ca.Certificate(), Cert: expiredCert, Key: key},
+			hosts:  []string{"other.default.svc"},
+			want:   exitExpired,
+			failed: []string{"expired", "hosts"},
+		},
+		"host mismatch": {
+			secret:  &k8s.Certs{CA: ca.Certificate(), Cert: cert, Key: key},
+			hosts:   []string{host, "webhook.default.svc.cluster.local"},
+			bundles: bundle,
+			want:    exitHostMismatch,
+			failed:  []string{"hosts"},
+		},
+		"chain invalid": {
+			secret:  &k8s.Certs{CA: ca.Certificate(), Cert: otherCert, Key: key},
+			hosts:   []string{host},
+			bundles: bundle,
+			want:    exitChainInvalid,
+			failed:  []string{"chain"},
+		},
+		"drift": {
+			secret:  &k8s.Certs{CA: ca.Certificate(), Cert: cert, Key: key},
+			hosts:   []string{host},
+			bundles: drifted,
+			want:    exitCABundleDrift,
+			failed:  []string{"caBundle"},
+		},
+		"host mismatch and drift": {
+			secret:  &k8s.Certs{CA: ca.Certificate(), Cert: cert, Key: key},
+			hosts:   []string{"other.default.svc"},
+			bundles: drifted,
+			want:    exitHostMismatch,
+			failed:  []string{"hosts", "caBundle"},
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			k := newFakeK8s()
+			c := &config.Certificate{SecretName: "webhook", Namespace: "default", Hosts: tc.hosts, CAName: "ca.crt", CertName: "tls.crt"}
+			if tc.secret != nil {
+				k.secrets[secretRef(c).String()] = tc.secret
+			}
+			k.bundles = tc.bundles
+
+			summary, err := verifyCertificate(context.Background(), k, c)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, summary.ExitCode)
+			var failed []string
+			for _, check := range summary.Checks {
+				if !check.OK {
+					failed = append(failed, check.Name)
+				}
+			}
+			assert.Equal(t, tc.failed, failed)
+			if tc.expired > 0 {
+				for _, check := range summary.Checks {
+					if check.Name == "expired" {
+						assert.Equal(t, tc.expired, strings.Count(check.Message, "expired at"), check.Message)
+					}
+				}
+			}
+		})
+	}
+}
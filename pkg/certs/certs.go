@@ -1,6 +1,8 @@
 package certs
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -15,86 +17,369 @@ import (
 	"github.com/pkg/errors"
 )
 
-// GenerateCerts venerates a ca with a leaf certificate and key and returns the ca, cert and key as PEM encoded slices.
-func GenerateCerts(host string) (ca []byte, cert []byte, key []byte, err error) {
-	notBefore := time.Now().Add(time.Minute * -5)
-	notAfter := notBefore.Add(100 * 365 * 24 * time.Hour)
+const (
+	// defaultValidity is how long certificates are valid unless WithValidity is given.
+	defaultValidity = 100 * 365 * 24 * time.Hour
+	// DefaultCACommonName is the common name of a ca unless WithSubject sets one.
+	DefaultCACommonName = "kube-webhook-certgen-ca"
+	// DefaultIntermediateCommonName is the common name of an intermediate ca unless WithSubject sets one.
+	DefaultIntermediateCommonName = "kube-webhook-certgen-intermediate-ca"
+	// maxCommonNameLength is the upper bound of the common name in RFC 5280.
+	maxCommonNameLength = 64
+)
 
-	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+// Option configures a certificate created by NewCA or CA.Issue.
+type Option func(*options)
+
+type options struct {
+	hosts           []string
+	notBefore       time.Time
+	validity        time.Duration
+	subject         *pkix.Name
+	nameConstraints []string
+	maxPathLen      int
+	clientAuth      bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		notBefore: time.Now().Add(time.Minute * -5),
+		validity:  defaultValidity,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithHosts sets the DNS names, IPs and URIs an issued certificate is valid for, see ParseHosts. It does not apply
+// to a ca, which has no SANs.
+func WithHosts(hosts ...string) Option {
+	return func(o *options) {
+		o.hosts = append(o.hosts, hosts...)
+	}
+}
+
+// WithValidity sets how long the certificate is valid. It defaults to 100 years.
+func WithValidity(validity time.Duration) Option {
+	return func(o *options) {
+		o.validity = validity
+	}
+}
+
+// WithSubject sets the subject of the certificate. When it has no common name, a ca gets DefaultCACommonName and
+// an issued certificate gets its first host, if short enough.
+func WithSubject(subject pkix.Name) Option {
+	return func(o *options) {
+		o.subject = &subject
+	}
+}
+
+// WithNameConstraints limits a ca to issuing certificates for the given DNS names, their subdomains, the given IPs
+// and URIs with the hosts of the given URIs, so that a leaked ca key cannot be used for other names. A wildcard
+// DNS name permits the domain below the wildcard. Types of names without any host are excluded entirely, e.g. a ca
+// limited to IPs cannot issue certificates for DNS names or URIs.
+func WithNameConstraints(hosts ...string) Option {
+	return func(o *options) {
+		o.nameConstraints = append(o.nameConstraints, hosts...)
+	}
+}
+
+// WithClientAuth makes an issued certificate a client certificate, e.g. for the API server to authenticate to a
+// webhook, instead of a serving certificate. Its common name and organizations are the user name and groups of the
+// client.
+func WithClientAuth() Option {
+	return func(o *options) {
+		o.clientAuth = true
+	}
+}
+
+// WithMaxPathLen sets how many intermediate cas may follow a ca in a chain. It defaults to 0, so that the ca can
+// only sign leaf certificates. A ca signing intermediates with CA.NewIntermediate needs at least 1.
+func WithMaxPathLen(n int) Option {
+	return func(o *options) {
+		o.maxPathLen = n
+	}
+}
+
+// subjectWithCommonName returns the subject with commonName unless it already has a common name.
+func (o *options) subjectWithCommonName(commonName string) pkix.Name {
+	var subject pkix.Name
+	if o.subject != nil {
+		subject = *o.subject
+	}
+	if subject.CommonName == "" && len(commonName) <= maxCommonNameLength {
+		subject.CommonName = commonName
+	}
+	return subject
+}
+
+// CA is a certificate authority issuing certificates. It is either a root or an intermediate ca, whose issuers
+// up to the root are kept to build certificate chains.
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	issuers []*x509.Certificate
+}
+
+// NewCA generates a self-signed ca and its key. The ca has no SANs and can only sign leaf certificates unless
+// WithMaxPathLen is given.
+func NewCA(opts ...Option) (*CA, error) {
+	return newCA(newOptions(opts), nil, DefaultCACommonName)
+}
+
+// NewIntermediate generates an intermediate ca and its key signed by ca, which needs a path length of at least 1.
+// The intermediate expires with ca at the latest.
+func (ca *CA) NewIntermediate(opts ...Option) (*CA, error) {
+	o := newOptions(opts)
+	if ca.cert.MaxPathLenZero || ca.cert.MaxPathLen == 0 {
+		return nil, errors.New("ca has a path length of 0 and cannot sign intermediate cas")
+	}
+	if ca.cert.MaxPathLen > 0 && o.maxPathLen >= ca.cert.MaxPathLen {
+		return nil, errors.Errorf("path length of the intermediate ca must be lower than %d", ca.cert.MaxPathLen)
+	}
+	return newCA(o, ca, DefaultIntermediateCommonName)
+}
+
+// LoadCA returns the ca of a PEM encoded certificate and key, e.g. an intermediate whose root is kept offline. The
+// certificate may be followed by its issuers up to the root, each signing the one before it.
+func LoadCA(cert, key []byte) (*CA, error) {
+	chain, err := ParseCertificates(cert)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid ca certificate")
+	}
+	if !chain[0].IsCA {
+		return nil, errors.New("certificate is not a ca")
+	}
+	for i := 1; i < len(chain); i++ {
+		if err := chain[i-1].CheckSignatureFrom(chain[i]); err != nil {
+			return nil, errors.Wrapf(err, "certificate %d of the ca chain is not signed by the next one", i-1)
+		}
+	}
+	signer, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	public, ok := chain[0].PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !public.Equal(signer.Public()) {
+		return nil, errors.New("ca key does not match the ca certificate")
+	}
+	return &CA{cert: chain[0], key: signer, issuers: chain[1:]}, nil
+}
+
+func newCA(o *options, parent *CA, commonName string) (*CA, error) {
+	serialNumber, err := newSerialNumber()
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "failed to generate serial number for CA certificate")
+		return nil, errors.Wrap(err, "failed to generate serial number for CA certificate")
 	}
-	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error creating root key for CA certificate")
+		return nil, errors.Wrap(err, "error creating key for CA certificate")
 	}
 
-	rootTemplate := x509.Certificate{
+	template := &x509.Certificate{
 		SerialNumber:          serialNumber,
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		NotBefore:             o.notBefore,
+		NotAfter:              o.notBefore.Add(o.validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
-		Subject:               pkix.Name{Organization: []string{"nil1"}},
+		MaxPathLen:            o.maxPathLen,
+		MaxPathLenZero:        o.maxPathLen == 0,
+		Subject:               o.subjectWithCommonName(commonName),
 	}
-	hosts := strings.Split(host, ",")
-	for _, h := range hosts {
-		if ip := net.ParseIP(h); ip != nil {
-			rootTemplate.IPAddresses = append(rootTemplate.IPAddresses, ip)
-		} else {
-			rootTemplate.DNSNames = append(rootTemplate.DNSNames, h)
-		}
+	if err := addNameConstraints(template, o.nameConstraints); err != nil {
+		return nil, err
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &rootTemplate, &rootTemplate, &rootKey.PublicKey, rootKey)
+	issuer, signer := template, crypto.Signer(caKey)
+	var issuers []*x509.Certificate
+	if parent != nil {
+		template.NotBefore = parent.clampNotBefore(template.NotBefore)
+		template.NotAfter = parent.clampNotAfter(template.NotAfter)
+		issuer, signer = parent.cert, parent.key
+		issuers = append([]*x509.Certificate{parent.cert}, parent.issuers...)
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, issuer, &caKey.PublicKey, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating CA certificate")
+	}
+	cert, err := x509.ParseCertificate(derBytes)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error creating CA certificate")
+		return nil, errors.Wrap(err, "error parsing CA certificate")
+	}
+
+	return &CA{cert: cert, key: caKey, issuers: issuers}, nil
+}
+
+// Certificate returns the PEM encoded certificate of the ca.
+func (ca *CA) Certificate() []byte {
+	return encodeCert(ca.cert.Raw)
+}
+
+// Chain returns the PEM encoded certificate of the ca followed by its issuers up to the root.
+func (ca *CA) Chain() []byte {
+	return encodeCerts(append([]*x509.Certificate{ca.cert}, ca.issuers...))
+}
+
+// Root returns the PEM encoded root certificate of the ca, which is the ca itself unless it is an intermediate.
+func (ca *CA) Root() []byte {
+	if len(ca.issuers) == 0 {
+		return ca.Certificate()
+	}
+	return encodeCert(ca.issuers[len(ca.issuers)-1].Raw)
+}
+
+// intermediates returns the certificates a client needs besides a root to verify a certificate issued by ca.
+func (ca *CA) intermediates() []*x509.Certificate {
+	var intermediates []*x509.Certificate
+	for _, c := range append([]*x509.Certificate{ca.cert}, ca.issuers...) {
+		if !isSelfSigned(c) {
+			intermediates = append(intermediates, c)
+		}
 	}
+	return intermediates
+}
+
+// constrainsDNSNames reports whether the ca or one of its issuers has DNS name constraints.
+func (ca *CA) constrainsDNSNames() bool {
+	for _, c := range append([]*x509.Certificate{ca.cert}, ca.issuers...) {
+		if len(c.PermittedDNSDomains) > 0 || len(c.ExcludedDNSDomains) > 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	ca = encodeCert(derBytes)
+// clampNotBefore keeps a certificate issued by the ca from being valid before the ca, which happens when the ca was
+// created less than the backdating of notBefore ago, e.g. by another tool.
+func (ca *CA) clampNotBefore(notBefore time.Time) time.Time {
+	if notBefore.Before(ca.cert.NotBefore) {
+		return ca.cert.NotBefore
+	}
+	return notBefore
+}
+
+func (ca *CA) clampNotAfter(notAfter time.Time) time.Time {
+	if notAfter.After(ca.cert.NotAfter) {
+		return ca.cert.NotAfter
+	}
+	return notAfter
+}
+
+// Issue generates a serving certificate, or a client certificate WithClientAuth, and its key signed by the ca and
+// returns them PEM encoded. The certificate is followed by the intermediate cas between it and the root, and is
+// valid within the validity period of the ca.
+func (ca *CA) Issue(opts ...Option) (cert, key []byte, err error) {
+	o := newOptions(opts)
+	sans, err := ParseHosts(o.hosts...)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error creating key for leaf certificate")
+		return nil, nil, errors.Wrap(err, "error creating key for leaf certificate")
 	}
 
 	key, err = encodeKey(leafKey)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error encoding leaf key")
+		return nil, nil, errors.Wrap(err, "error encoding leaf key")
 	}
 
-	serialNumber, err = rand.Int(rand.Reader, serialNumberLimit)
+	serialNumber, err := newSerialNumber()
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error creating serial number for leaf certificate")
+		return nil, nil, errors.Wrap(err, "error creating serial number for leaf certificate")
+	}
+	commonName := sans.commonName()
+	// OpenSSL checks a common name that looks like a DNS name, such as an IP, against the DNS name constraints.
+	if len(sans.DNSNames) == 0 && ca.constrainsDNSNames() {
+		commonName = ""
 	}
-	leafTemplate := x509.Certificate{
+	leafTemplate := &x509.Certificate{
 		SerialNumber:          serialNumber,
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
+		NotBefore:             ca.clampNotBefore(o.notBefore),
+		NotAfter:              ca.clampNotAfter(o.notBefore.Add(o.validity)),
 		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
 		BasicConstraintsValid: true,
 		IsCA:                  false,
-		Subject:               pkix.Name{Organization: []string{"nil2"}},
+		Subject:               o.subjectWithCommonName(commonName),
+		DNSNames:              sans.DNSNames,
+		IPAddresses:           sans.IPAddresses,
+		URIs:                  sans.URIs,
 	}
-	for _, h := range hosts {
-		if ip := net.ParseIP(h); ip != nil {
-			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
-		} else {
-			leafTemplate.DNSNames = append(leafTemplate.DNSNames, h)
-		}
+	if o.clientAuth {
+		leafTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+		leafTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
 	}
 
-	derBytes, err = x509.CreateCertificate(rand.Reader, &leafTemplate, &rootTemplate, &leafKey.PublicKey, rootKey)
+	derBytes, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca.cert, &leafKey.PublicKey, ca.key)
 	if err != nil {
-		return nil, nil, nil, errors.Wrap(err, "error creating leaf certificate")
+		return nil, nil, errors.Wrap(err, "error creating leaf certificate")
 	}
 
-	cert = encodeCert(derBytes)
-	return ca, cert, key, nil
+	return append(encodeCert(derBytes), encodeCerts(ca.intermediates())...), key, nil
+}
+
+// GenerateCerts generates a ca with a leaf certificate and key for the comma-separated hosts and returns the ca,
+// cert and key as PEM encoded slices. Use NewCA and CA.Issue for more control.
+func GenerateCerts(host string) (ca []byte, cert []byte, key []byte, err error) {
+	hosts := strings.Split(host, ",")
+	authority, err := NewCA()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cert, key, err = authority.Issue(WithHosts(hosts...))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return authority.Certificate(), cert, key, nil
+}
+
+func addNameConstraints(template *x509.Certificate, hosts []string) error {
+	if len(hosts) == 0 {
+		return nil
+	}
+	sans, err := ParseHosts(hosts...)
+	if err != nil {
+		return err
+	}
+	template.PermittedDNSDomainsCritical = true
+	for _, name := range sans.DNSNames {
+		template.PermittedDNSDomains = append(template.PermittedDNSDomains, strings.TrimPrefix(name, "*."))
+	}
+	for _, ip := range sans.IPAddresses {
+		if ip4 := ip.To4(); ip4 != nil {
+			template.PermittedIPRanges = append(template.PermittedIPRanges, &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			template.PermittedIPRanges = append(template.PermittedIPRanges, &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
+		}
+	}
+	for _, u := range sans.URIs {
+		template.PermittedURIDomains = append(template.PermittedURIDomains, u.Hostname())
+	}
+	// Without permitted names of a type any name of that type would be allowed, so exclude them all. An empty
+	// domain matches every DNS name and URI host.
+	if len(template.PermittedDNSDomains) == 0 {
+		template.ExcludedDNSDomains = []string{""}
+	}
+	if len(template.PermittedIPRanges) == 0 {
+		template.ExcludedIPRanges = []*net.IPNet{
+			{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)},
+			{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+		}
+	}
+	if len(template.PermittedURIDomains) == 0 {
+		template.ExcludedURIDomains = []string{""}
+	}
+	return nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	return rand.Int(rand.Reader, serialNumberLimit)
 }
 
 func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
@@ -108,3 +393,46 @@ func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
 func encodeCert(derBytes []byte) []byte {
 	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
 }
+
+func encodeCerts(certs []*x509.Certificate) []byte {
+	var data []byte
+	for _, c := range certs {
+		data = append(data, encodeCert(c.Raw)...)
+	}
+	return data
+}
+
+// parseKey decodes the first PEM encoded EC, PKCS #1 or PKCS #8 private key of data.
+func parseKey(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key found in PEM data")
+		}
+		var key any
+		var err error
+		switch block.Type {
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing private key")
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	return bytes.Equal(c.RawIssuer, c.RawSubject) && c.CheckSignatureFrom(c) == nil
+}
@@ -3,13 +3,16 @@ package certs
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -73,3 +76,238 @@ func TestCertificateCreation(t *testing.T) {
 		t.Errorf("response body was '%v'; want '%v'", expected, body)
 	}
 }
+
+func TestIssue(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA(WithValidity(time.Hour))
+	assert.NoError(t, err)
+
+	cert, key, err := ca.Issue(WithHosts("webhook.default.svc", "10.0.0.1"), WithValidity(2*time.Hour))
+	assert.NoError(t, err)
+	_, err = tls.X509KeyPair(cert, key)
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyChain(ca.Certificate(), cert))
+
+	caCerts, err := ParseCertificates(ca.Certificate())
+	assert.NoError(t, err)
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webhook.default.svc"}, leafCerts[0].DNSNames)
+	assert.Equal(t, "10.0.0.1", leafCerts[0].IPAddresses[0].String())
+	assert.Equal(t, caCerts[0].NotAfter, leafCerts[0].NotAfter, "leaf must not outlive its ca")
+}
+
+func TestCAProfile(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA(WithHosts("ignored.example.com"), WithSubject(pkix.Name{CommonName: "test ca"}))
+	assert.NoError(t, err)
+
+	caCerts, err := ParseCertificates(ca.Certificate())
+	assert.NoError(t, err)
+	root := caCerts[0]
+	assert.True(t, root.IsCA)
+	assert.Equal(t, 0, root.MaxPathLen)
+	assert.True(t, root.MaxPathLenZero)
+	assert.Empty(t, root.DNSNames)
+	assert.Empty(t, root.IPAddresses)
+	assert.Empty(t, root.ExtKeyUsage)
+	assert.Equal(t, "test ca", root.Subject.CommonName)
+}
+
+func TestNameConstraints(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		constraints []string
+		permitted   []string
+		excluded    []string
+	}{
+		{
+			constraints: []string{"webhook.default.svc"},
+			permitted:   []string{"webhook.default.svc", "a.webhook.default.svc"},
+			excluded:    []string{"other.default.svc", "10.0.0.1", "::1", "spiffe://cluster.local/ns/default"},
+		},
+		{
+			constraints: []string{"10.0.0.1"},
+			permitted:   []string{"10.0.0.1"},
+			excluded:    []string{"evil.example.com", "10.0.0.2", "spiffe://evil.example.com/ns/default"},
+		},
+		{
+			constraints: []string{"spiffe://cluster.local/ns/default"},
+			permitted:   []string{"spiffe://cluster.local/ns/other"},
+			excluded:    []string{"cluster.local", "10.0.0.1", "spiffe://evil.example.com/ns/default"},
+		},
+		{
+			constraints: []string{"webhook.default.svc", "10.0.0.1", "spiffe://cluster.local/ns/default"},
+			permitted:   []string{"webhook.default.svc", "10.0.0.1", "spiffe://cluster.local/ns/default"},
+			excluded:    []string{"evil.example.com", "10.0.0.2", "spiffe://evil.example.com/ns/default"},
+		},
+	} {
+		ca, err := NewCA(WithNameConstraints(tc.constraints...))
+		assert.NoError(t, err)
+
+		for _, host := range tc.permitted {
+			cert, _, err := ca.Issue(WithHosts(host))
+			assert.NoError(t, err)
+			assert.NoError(t, VerifyChain(ca.Certificate(), cert), "%s under %v", host, tc.constraints)
+		}
+		for _, host := range tc.excluded {
+			cert, _, err := ca.Issue(WithHosts(host))
+			assert.NoError(t, err)
+			assert.Error(t, VerifyChain(ca.Certificate(), cert), "%s under %v", host, tc.constraints)
+		}
+	}
+
+	// OpenSSL would check a common name holding the IP against the exclusion of all DNS names.
+	ca, err := NewCA(WithNameConstraints("10.0.0.1"))
+	assert.NoError(t, err)
+	cert, _, err := ca.Issue(WithHosts("10.0.0.1"))
+	assert.NoError(t, err)
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Empty(t, leafCerts[0].Subject.CommonName)
+}
+
+func TestSubjectDefaults(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA(WithSubject(pkix.Name{Organization: []string{"example"}}))
+	assert.NoError(t, err)
+	cert, _, err := ca.Issue(WithHosts("webhook.default.svc", "10.0.0.1"))
+	assert.NoError(t, err)
+
+	caCerts, err := ParseCertificates(ca.Certificate())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCACommonName, caCerts[0].Subject.CommonName)
+	assert.Equal(t, []string{"example"}, caCerts[0].Subject.Organization)
+
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Equal(t, "webhook.default.svc", leafCerts[0].Subject.CommonName)
+	assert.Equal(t, caCerts[0].Subject.String(), leafCerts[0].Issuer.String())
+}
+
+func TestIntermediate(t *testing.T) {
+	t.Parallel()
+
+	leafOnly, err := NewCA()
+	assert.NoError(t, err)
+	_, err = leafOnly.NewIntermediate()
+	assert.Error(t, err, "a ca with a path length of 0 must not sign intermediates")
+
+	root, err := NewCA(WithMaxPathLen(1))
+	assert.NoError(t, err)
+	intermediate, err := root.NewIntermediate()
+	assert.NoError(t, err)
+	assert.Equal(t, root.Certificate(), intermediate.Root())
+
+	chain, err := ParseCertificates(intermediate.Chain())
+	assert.NoError(t, err)
+	assert.Len(t, chain, 2)
+	assert.Equal(t, DefaultIntermediateCommonName, chain[0].Subject.CommonName)
+	assert.True(t, chain[0].MaxPathLenZero)
+
+	cert, key, err := intermediate.Issue(WithHosts("webhook.default.svc"))
+	assert.NoError(t, err)
+	_, err = tls.X509KeyPair(cert, key)
+	assert.NoError(t, err)
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Len(t, leafCerts, 2, "certificate must be followed by the intermediate")
+	assert.NoError(t, VerifyChain(root.Certificate(), cert))
+}
+
+func TestLoadCA(t *testing.T) {
+	t.Parallel()
+
+	root, err := NewCA(WithMaxPathLen(1))
+	assert.NoError(t, err)
+	intermediate, err := root.NewIntermediate()
+	assert.NoError(t, err)
+	key, err := encodeKey(intermediate.key.(*ecdsa.PrivateKey))
+	assert.NoError(t, err)
+
+	loaded, err := LoadCA(intermediate.Chain(), key)
+	assert.NoError(t, err)
+	assert.Equal(t, root.Certificate(), loaded.Root())
+	cert, _, err := loaded.Issue(WithHosts("webhook.default.svc"))
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyChain(root.Certificate(), cert))
+
+	_, err = LoadCA(root.Certificate(), key)
+	assert.Error(t, err, "key of another ca")
+	_, err = LoadCA(append(root.Certificate(), intermediate.Certificate()...), key)
+	assert.Error(t, err, "issuers out of order")
+	_, leaf, leafKey, err := GenerateCerts("localhost")
+	assert.NoError(t, err)
+	_, err = LoadCA(leaf, leafKey)
+	assert.Error(t, err, "leaf certificate")
+}
+
+func TestIssueFromNewCA(t *testing.T) {
+	t.Parallel()
+
+	// A ca created just now, e.g. by another tool, is not valid yet at the backdated notBefore of its certificates.
+	o := newOptions([]Option{WithMaxPathLen(1)})
+	o.notBefore = time.Now().Truncate(time.Second)
+	ca, err := newCA(o, nil, DefaultCACommonName)
+	assert.NoError(t, err)
+
+	intermediate, err := ca.NewIntermediate()
+	assert.NoError(t, err)
+	assert.False(t, intermediate.cert.NotBefore.Before(ca.cert.NotBefore))
+
+	cert, _, err := ca.Issue(WithHosts("webhook.default.svc"))
+	assert.NoError(t, err)
+	parsed, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Equal(t, ca.cert.NotBefore, parsed[0].NotBefore)
+	assert.NoError(t, VerifyChain(ca.Certificate(), cert))
+}
+
+func TestClientAuth(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA()
+	assert.NoError(t, err)
+	cert, key, err := ca.Issue(WithClientAuth(), WithSubject(pkix.Name{CommonName: "kube-apiserver", Organization: []string{"system:masters"}}))
+	assert.NoError(t, err)
+	_, err = tls.X509KeyPair(cert, key)
+	assert.NoError(t, err)
+
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, leafCerts[0].ExtKeyUsage)
+	assert.Equal(t, "kube-apiserver", leafCerts[0].Subject.CommonName)
+	assert.Empty(t, leafCerts[0].DNSNames)
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.Certificate())
+	_, err = leafCerts[0].Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	assert.NoError(t, err)
+}
+
+func TestURIAndWildcardSANs(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA(WithNameConstraints("*.webhook.default.svc", "spiffe://cluster.local"))
+	assert.NoError(t, err)
+
+	cert, _, err := ca.Issue(WithHosts("*.webhook.default.svc", "spiffe://cluster.local/ns/default/sa/webhook"))
+	assert.NoError(t, err)
+	assert.NoError(t, VerifyChain(ca.Certificate(), cert))
+
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.webhook.default.svc"}, leafCerts[0].DNSNames)
+	assert.Equal(t, "spiffe://cluster.local/ns/default/sa/webhook", leafCerts[0].URIs[0].String())
+
+	cert, _, err = ca.Issue(WithHosts("spiffe://other.local/ns/default/sa/webhook"))
+	assert.NoError(t, err)
+	assert.Error(t, VerifyChain(ca.Certificate(), cert))
+
+	_, _, err = ca.Issue(WithHosts("webhook..svc"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package certs
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const dirMode = 0o755
+
+// Files describes where PEM encoded certificates are stored on the local filesystem.
+type Files struct {
+	Dir      string
+	CAName   string
+	CertName string
+	KeyName  string
+	CertMode os.FileMode
+	KeyMode  os.FileMode
+}
+
+// Read returns the content of the ca, cert and key files. If the ca file does not exist, all are nil.
+func (f Files) Read() (ca, cert, key []byte, err error) {
+	ca, err = os.ReadFile(filepath.Join(f.Dir, f.CAName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, nil, nil
+		}
+		return nil, nil, nil, errors.Wrap(err, "error reading ca file")
+	}
+	cert, err = os.ReadFile(filepath.Join(f.Dir, f.CertName))
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error reading cert file")
+	}
+	key, err = os.ReadFile(filepath.Join(f.Dir, f.KeyName))
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "error reading key file")
+	}
+	return ca, cert, key, nil
+}
+
+// Write stores the ca, cert and key into their files, creating the directory when needed. The ca and cert
+// files get CertMode and the key file gets KeyMode. Files with an empty name are not written.
+func (f Files) Write(ca, cert, key []byte) error {
+	if err := os.MkdirAll(f.Dir, dirMode); err != nil {
+		return errors.Wrapf(err, "error creating directory %s", f.Dir)
+	}
+	for _, file := range []struct {
+		name string
+		data []byte
+		mode os.FileMode
+	}{
+		{f.CAName, ca, f.CertMode},
+		{f.CertName, cert, f.CertMode},
+		{f.KeyName, key, f.KeyMode},
+	} {
+		if file.name == "" {
+			continue
+		}
+		path := filepath.Join(f.Dir, file.name)
+		if err := os.WriteFile(path, file.data, file.mode); err != nil {
+			return errors.Wrapf(err, "error writing %s", path)
+		}
+		// WriteFile only applies the mode to new files and is subject to the umask.
+		if err := os.Chmod(path, file.mode); err != nil {
+			return errors.Wrapf(err, "error setting mode of %s", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package certs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteThenReadFiles(t *testing.T) {
+	t.Parallel()
+
+	f := Files{
+		Dir:      filepath.Join(t.TempDir(), "certs"),
+		CAName:   "ca.crt",
+		CertName: "tls.crt",
+		KeyName:  "tls.key",
+		CertMode: 0o644,
+		KeyMode:  0o600,
+	}
+
+	ca, cert, key, err := f.Read()
+	assert.NoError(t, err)
+	assert.Nil(t, ca)
+	assert.Nil(t, cert)
+	assert.Nil(t, key)
+
+	assert.NoError(t, f.Write([]byte("ca"), []byte("cert"), []byte("key")))
+
+	ca, cert, key, err = f.Read()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ca"), ca)
+	assert.Equal(t, []byte("cert"), cert)
+	assert.Equal(t, []byte("key"), key)
+
+	info, err := os.Stat(filepath.Join(f.Dir, "tls.key"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Join(f.Dir, "tls.crt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+}
+
+func TestWriteSkipsUnnamedFiles(t *testing.T) {
+	t.Parallel()
+
+	f := Files{Dir: t.TempDir(), CertName: "client.crt", KeyName: "client.key", CertMode: 0o644, KeyMode: 0o600}
+	assert.NoError(t, f.Write(nil, []byte("cert"), []byte("key")))
+
+	entries, err := os.ReadDir(f.Dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
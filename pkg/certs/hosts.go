@@ -0,0 +1,190 @@
+package certs
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxDNSNameLength  = 253
+	maxDNSLabelLength = 63
+)
+
+// SANs are the subject alternative names of a certificate.
+type SANs struct {
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+}
+
+// ParseHosts classifies hosts as IP addresses, URIs such as spiffe://cluster.local/ns/default/sa/webhook, or DNS
+// names, which may start with a "*" wildcard label. Hosts are normalized by NormalizeHosts first.
+func ParseHosts(hosts ...string) (*SANs, error) {
+	normalized, err := NormalizeHosts(hosts)
+	if err != nil {
+		return nil, err
+	}
+	sans := &SANs{}
+	for _, h := range normalized {
+		if ip := net.ParseIP(h); ip != nil {
+			sans.IPAddresses = append(sans.IPAddresses, ip)
+			continue
+		}
+		if strings.Contains(h, "://") {
+			u, err := url.Parse(h)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid URI '%s'", h)
+			}
+			sans.URIs = append(sans.URIs, u)
+			continue
+		}
+		sans.DNSNames = append(sans.DNSNames, h)
+	}
+	return sans, nil
+}
+
+// NormalizeHosts trims spaces, drops empty entries and duplicates, and returns the canonical form of each host:
+// IPs without IPv6 brackets, URIs with a lower-case scheme and host, and lower-case DNS names with international
+// labels converted to their ASCII form. Malformed hosts are rejected.
+func NormalizeHosts(hosts []string) ([]string, error) {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, h := range hosts {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		n, err := normalizeHost(h)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[n] {
+			seen[n] = true
+			normalized = append(normalized, n)
+		}
+	}
+	return normalized, nil
+}
+
+func normalizeHost(h string) (string, error) {
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(h, "["), "]")); ip != nil {
+		return ip.String(), nil
+	}
+	if strings.Contains(h, "://") {
+		u, err := parseURI(h)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid URI '%s'", h)
+		}
+		return u.String(), nil
+	}
+	name, err := toASCII(h)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid DNS name '%s'", h)
+	}
+	if err := validateDNSName(name); err != nil {
+		return "", errors.Wrapf(err, "invalid DNS name '%s'", h)
+	}
+	return name, nil
+}
+
+// toASCII returns the lower-case ASCII form of a DNS name, keeping a leading wildcard label.
+func toASCII(name string) (string, error) {
+	wildcard := strings.HasPrefix(name, "*.")
+	name = strings.ToLower(strings.TrimPrefix(name, "*."))
+	if !isASCII(name) {
+		converted, err := idna.Lookup.ToASCII(name)
+		if err != nil {
+			return "", errors.Wrap(err, "error converting international name")
+		}
+		name = converted
+	}
+	if wildcard {
+		name = "*." + name
+	}
+	return name, nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// commonName returns the first DNS name or else the first IP, as URIs are no host names.
+func (s *SANs) commonName() string {
+	switch {
+	case len(s.DNSNames) > 0:
+		return s.DNSNames[0]
+	case len(s.IPAddresses) > 0:
+		return s.IPAddresses[0].String()
+	default:
+		return ""
+	}
+}
+
+func parseURI(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing URI")
+	}
+	if u.Host == "" {
+		return nil, errors.New("URI has no host")
+	}
+	if u.User != nil {
+		return nil, errors.New("URI must not have user information")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+// validateDNSName checks that name consists of letters, digits and hyphens in labels of at most 63 characters,
+// which do not start or end with a hyphen. Only the leftmost label may be a "*" wildcard, followed by at least two
+// labels so that it cannot match a whole top-level domain.
+func validateDNSName(name string) error {
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	if len(name) > maxDNSNameLength {
+		return errors.Errorf("name is longer than %d characters", maxDNSNameLength)
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 {
+			if len(labels) < 3 {
+				return errors.New("wildcard must be followed by at least two labels")
+			}
+			continue
+		}
+		if err := validateDNSLabel(label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateDNSLabel(label string) error {
+	switch {
+	case label == "":
+		return errors.New("name has an empty label")
+	case len(label) > maxDNSLabelLength:
+		return errors.Errorf("label '%s' is longer than %d characters", label, maxDNSLabelLength)
+	case strings.Contains(label, "*"):
+		return errors.New("only the whole leftmost label may be a wildcard")
+	case label[0] == '-' || label[len(label)-1] == '-':
+		return errors.Errorf("label '%s' starts or ends with a hyphen", label)
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+			return errors.Errorf("label '%s' contains '%c'", label, r)
+		}
+	}
+	return nil
+}
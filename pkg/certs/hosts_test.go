@@ -0,0 +1,56 @@
+package certs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHosts(t *testing.T) {
+	t.Parallel()
+
+	sans, err := ParseHosts("webhook.default.svc", "*.webhook.default.svc", "10.0.0.1", "::1", "spiffe://cluster.local/ns/default/sa/webhook")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webhook.default.svc", "*.webhook.default.svc"}, sans.DNSNames)
+	assert.Len(t, sans.IPAddresses, 2)
+	assert.Equal(t, "spiffe://cluster.local/ns/default/sa/webhook", sans.URIs[0].String())
+	assert.Equal(t, "webhook.default.svc", sans.commonName())
+}
+
+func TestNormalizeHosts(t *testing.T) {
+	t.Parallel()
+
+	hosts, err := NormalizeHosts([]string{
+		" Webhook.Default.SVC", "", "webhook.default.svc ", "[::1]", "0:0:0:0:0:0:0:1", "*.Bücher.example",
+		"SPIFFE://Cluster.Local/ns/Default",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webhook.default.svc", "::1", "*.xn--bcher-kva.example", "spiffe://cluster.local/ns/Default"}, hosts)
+
+	_, err = NormalizeHosts([]string{"a", "b..c"})
+	assert.EqualError(t, err, "invalid DNS name 'b..c': name has an empty label")
+}
+
+func TestParseHostsRejectsMalformed(t *testing.T) {
+	t.Parallel()
+
+	for _, host := range []string{
+		"webhook..svc",
+		"webhook.default.svc.",
+		"-webhook.default.svc",
+		"webhook_1.default.svc",
+		"web hook.default.svc",
+		"*.svc",
+		"*",
+		"webhook.*.svc",
+		"*webhook.default.svc",
+		strings.Repeat("a", 64) + ".svc",
+		strings.Repeat("a.", 127) + "svc",
+		"spiffe:///ns/default",
+		"https://user@webhook.default.svc",
+	} {
+		_, err := ParseHosts(host)
+		assert.Error(t, err, host)
+	}
+}
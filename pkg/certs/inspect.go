@@ -0,0 +1,125 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SHA-1 fingerprints are only displayed, never used for verification.
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Info is a human and machine readable description of a certificate.
+type Info struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serialNumber"`
+	IsCA              bool      `json:"isCA"`
+	DNSNames          []string  `json:"dnsNames,omitempty"`
+	IPAddresses       []string  `json:"ipAddresses,omitempty"`
+	URIs              []string  `json:"uris,omitempty"`
+	KeyType           string    `json:"keyType"`
+	SHA1Fingerprint   string    `json:"sha1Fingerprint"`
+	SHA256Fingerprint string    `json:"sha256Fingerprint"`
+	NotBefore         time.Time `json:"notBefore"`
+	NotAfter          time.Time `json:"notAfter"`
+}
+
+// ParseCertificates decodes every CERTIFICATE block of the PEM encoded data.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found in PEM data")
+	}
+	return certs, nil
+}
+
+// RootCertificates returns the self-signed certificates of the PEM encoded data, leaving out intermediate cas. Data
+// without intermediates is returned as is.
+func RootCertificates(data []byte) ([]byte, error) {
+	certs, err := ParseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	var roots []*x509.Certificate
+	for _, c := range certs {
+		if isSelfSigned(c) {
+			roots = append(roots, c)
+		}
+	}
+	switch len(roots) {
+	case 0:
+		return nil, errors.New("no root certificate found in PEM data")
+	case len(certs):
+		return data, nil
+	default:
+		return encodeCerts(roots), nil
+	}
+}
+
+// Describe returns the Info of a certificate.
+func Describe(cert *x509.Certificate) Info {
+	sha1Sum := sha1.Sum(cert.Raw) //nolint:gosec // See import.
+	sha256Sum := sha256.Sum256(cert.Raw)
+	info := Info{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SerialNumber:      cert.SerialNumber.Text(16),
+		IsCA:              cert.IsCA,
+		DNSNames:          cert.DNSNames,
+		KeyType:           keyType(cert.PublicKey),
+		SHA1Fingerprint:   fingerprint(sha1Sum[:]),
+		SHA256Fingerprint: fingerprint(sha256Sum[:]),
+		NotBefore:         cert.NotBefore,
+		NotAfter:          cert.NotAfter,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+	for _, u := range cert.URIs {
+		info.URIs = append(info.URIs, u.String())
+	}
+	return info
+}
+
+func keyType(key any) string {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", key)
+	}
+}
+
+func fingerprint(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,64 @@
+package certs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	t.Parallel()
+
+	ca, cert, _, err := GenerateCerts("localhost,127.0.0.1")
+	assert.NoError(t, err)
+
+	caCerts, err := ParseCertificates(ca)
+	assert.NoError(t, err)
+	assert.Len(t, caCerts, 1)
+
+	leafCerts, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+	assert.Len(t, leafCerts, 1)
+
+	info := Describe(leafCerts[0])
+	assert.False(t, info.IsCA)
+	assert.Equal(t, []string{"localhost"}, info.DNSNames)
+	assert.Equal(t, []string{"127.0.0.1"}, info.IPAddresses)
+	assert.Equal(t, "ECDSA P-256", info.KeyType)
+	assert.Len(t, strings.Split(info.SHA256Fingerprint, ":"), 32)
+	assert.Len(t, strings.Split(info.SHA1Fingerprint, ":"), 20)
+	assert.True(t, info.NotBefore.Before(info.NotAfter))
+
+	assert.True(t, Describe(caCerts[0]).IsCA)
+}
+
+func TestParseCertificatesWithoutCertificate(t *testing.T) {
+	t.Parallel()
+
+	_, _, key, err := GenerateCerts("localhost")
+	assert.NoError(t, err)
+
+	_, err = ParseCertificates(key)
+	assert.Error(t, err)
+}
+
+func TestRootCertificates(t *testing.T) {
+	t.Parallel()
+
+	root, err := NewCA(WithMaxPathLen(1))
+	assert.NoError(t, err)
+	intermediate, err := root.NewIntermediate()
+	assert.NoError(t, err)
+
+	roots, err := RootCertificates(intermediate.Chain())
+	assert.NoError(t, err)
+	assert.Equal(t, root.Certificate(), roots)
+
+	roots, err = RootCertificates(root.Certificate())
+	assert.NoError(t, err)
+	assert.Equal(t, root.Certificate(), roots)
+
+	_, err = RootCertificates(intermediate.Certificate())
+	assert.Error(t, err)
+}
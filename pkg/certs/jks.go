@@ -0,0 +1,42 @@
+package certs
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"github.com/pkg/errors"
+)
+
+// EncodeJKSTruststore returns a JKS truststore protected by password that trusts every certificate of the PEM
+// encoded ca under the aliases of EncodePKCS12Truststore. Unlike PKCS #12 truststores encrypted with AES, it can be
+// read by every Java version.
+func EncodeJKSTruststore(ca []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("truststore password must not be empty")
+	}
+	cas, err := ParseCertificates(ca)
+	if err != nil {
+		return nil, err
+	}
+	if len(cas) == 0 {
+		return nil, errors.New("no certificate to add to the truststore")
+	}
+
+	ks := keystore.New(keystore.WithOrderedAliases())
+	now := time.Now()
+	for i, c := range cas {
+		entry := keystore.TrustedCertificateEntry{
+			CreationTime: now,
+			Certificate:  keystore.Certificate{Type: "X509", Content: c.Raw},
+		}
+		if err := ks.SetTrustedCertificateEntry(truststoreAlias(i), entry); err != nil {
+			return nil, errors.Wrap(err, "failed to add certificate to truststore")
+		}
+	}
+	var buf bytes.Buffer
+	if err := ks.Store(&buf, []byte(password)); err != nil {
+		return nil, errors.Wrap(err, "failed to encode truststore")
+	}
+	return buf.Bytes(), nil
+}
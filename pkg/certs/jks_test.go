@@ -0,0 +1,36 @@
+package certs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeJKSTruststore(t *testing.T) {
+	t.Parallel()
+
+	root, err := NewCA(WithMaxPathLen(1))
+	assert.NoError(t, err)
+	intermediate, err := root.NewIntermediate()
+	assert.NoError(t, err)
+
+	_, err = EncodeJKSTruststore(intermediate.Chain(), "")
+	assert.Error(t, err)
+
+	data, err := EncodeJKSTruststore(intermediate.Chain(), "changeit")
+	assert.NoError(t, err)
+
+	assert.Error(t, keystore.New().Load(bytes.NewReader(data), []byte("wrong")))
+	ks := keystore.New()
+	assert.NoError(t, ks.Load(bytes.NewReader(data), []byte("changeit")))
+	want, err := ParseCertificates(intermediate.Chain())
+	assert.NoError(t, err)
+	assert.Len(t, ks.Aliases(), len(want))
+	for i, c := range want {
+		entry, err := ks.GetTrustedCertificateEntry(truststoreAlias(i))
+		assert.NoError(t, err)
+		assert.Equal(t, c.Raw, entry.Certificate.Content)
+	}
+}
@@ -0,0 +1,85 @@
+package certs
+
+import (
+	"crypto/x509"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// TruststoreAlias is the alias of the first certificate in truststores written by EncodePKCS12Truststore and
+// EncodeJKSTruststore. Further certificates get the alias with a -1, -2, ... suffix.
+const TruststoreAlias = "ca"
+
+// EncodePKCS12 returns a PKCS #12 keystore protected by password, holding the PEM encoded key and the chain of the
+// PEM encoded cert. The chain is the cert followed by the certificates of the PEM encoded ca that it does not contain
+// yet, so that it ends with the root. The keystore is encrypted with AES-256 and authenticated with HMAC-SHA256,
+// which Java 17, 11.0.12 and later and 8u301 and later, OpenSSL 1.1.1 and later and Go readers support.
+func EncodePKCS12(cert, key, ca []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("keystore password must not be empty")
+	}
+	chain, err := ParseCertificates(cert)
+	if err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate to add to the keystore")
+	}
+	cas, err := ParseCertificates(ca)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range cas {
+		if !containsCertificate(chain, c) {
+			chain = append(chain, c)
+		}
+	}
+	signer, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := pkcs12.Modern2023.Encode(signer, chain[0], chain[1:], password)
+	return data, errors.Wrap(err, "failed to encode keystore")
+}
+
+// EncodePKCS12Truststore returns a PKCS #12 truststore protected by password that trusts every certificate of the
+// PEM encoded ca, e.g. for a Java client of the webhook.
+func EncodePKCS12Truststore(ca []byte, password string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("truststore password must not be empty")
+	}
+	cas, err := ParseCertificates(ca)
+	if err != nil {
+		return nil, err
+	}
+	if len(cas) == 0 {
+		return nil, errors.New("no certificate to add to the truststore")
+	}
+
+	entries := make([]pkcs12.TrustStoreEntry, len(cas))
+	for i, c := range cas {
+		entries[i] = pkcs12.TrustStoreEntry{Cert: c, FriendlyName: truststoreAlias(i)}
+	}
+	data, err := pkcs12.Modern2023.EncodeTrustStoreEntries(entries, password)
+	return data, errors.Wrap(err, "failed to encode truststore")
+}
+
+// truststoreAlias returns the alias of the i-th certificate of a truststore.
+func truststoreAlias(i int) string {
+	if i == 0 {
+		return TruststoreAlias
+	}
+	return TruststoreAlias + "-" + strconv.Itoa(i)
+}
+
+func containsCertificate(certs []*x509.Certificate, c *x509.Certificate) bool {
+	for _, other := range certs {
+		if other.Equal(c) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package certs
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func TestEncodePKCS12(t *testing.T) {
+	t.Parallel()
+
+	root, err := NewCA(WithMaxPathLen(1))
+	assert.NoError(t, err)
+	intermediate, err := root.NewIntermediate()
+	assert.NoError(t, err)
+	cert, key, err := intermediate.Issue(WithHosts("webhook.default.svc"))
+	assert.NoError(t, err)
+
+	_, err = EncodePKCS12(cert, key, intermediate.Chain(), "")
+	assert.Error(t, err)
+
+	data, err := EncodePKCS12(cert, key, intermediate.Chain(), "changeit")
+	assert.NoError(t, err)
+
+	_, _, _, err = pkcs12.DecodeChain(data, "wrong")
+	assert.Error(t, err)
+	parsedKey, leaf, chain, err := pkcs12.DecodeChain(data, "changeit")
+	assert.NoError(t, err)
+	want, err := ParseCertificates(append(cert, root.Certificate()...))
+	assert.NoError(t, err)
+	assert.Equal(t, want[0].Raw, leaf.Raw)
+	assert.Len(t, chain, len(want)-1)
+	for i, c := range chain {
+		assert.Equal(t, want[i+1].Raw, c.Raw)
+	}
+	signer, err := parseKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, signer.Public(), parsedKey.(crypto.Signer).Public())
+}
+
+func TestEncodePKCS12Truststore(t *testing.T) {
+	t.Parallel()
+
+	root, err := NewCA(WithMaxPathLen(1))
+	assert.NoError(t, err)
+	intermediate, err := root.NewIntermediate()
+	assert.NoError(t, err)
+
+	_, err = EncodePKCS12Truststore(intermediate.Chain(), "")
+	assert.Error(t, err)
+
+	data, err := EncodePKCS12Truststore(intermediate.Chain(), "changeit")
+	assert.NoError(t, err)
+
+	_, err = pkcs12.DecodeTrustStore(data, "wrong")
+	assert.Error(t, err)
+	trusted, err := pkcs12.DecodeTrustStore(data, "changeit")
+	assert.NoError(t, err)
+	want, err := ParseCertificates(intermediate.Chain())
+	assert.NoError(t, err)
+	assert.Len(t, trusted, len(want))
+	for i, c := range trusted {
+		assert.Equal(t, want[i].Raw, c.Raw)
+	}
+}
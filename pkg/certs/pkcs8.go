@@ -0,0 +1,36 @@
+package certs
+
+import (
+	"crypto"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+	"github.com/youmark/pkcs8"
+)
+
+// pbkdf2Iterations is the iteration count of EncryptKey, which OWASP recommends for PBKDF2-HMAC-SHA256.
+const pbkdf2Iterations = 600000
+
+// EncryptKey returns the PEM encoded key as an ENCRYPTED PRIVATE KEY: PKCS #8 encrypted with AES-256-CBC under a
+// key derived from passphrase with PBKDF2-HMAC-SHA256, which openssl pkcs8 and most TLS libraries can decrypt.
+func EncryptKey(key []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("key passphrase must not be empty")
+	}
+	signer, err := parseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	der, err := pkcs8.MarshalPrivateKey(signer, []byte(passphrase), &pkcs8.Opts{
+		Cipher: pkcs8.AES256CBC,
+		KDFOpts: pkcs8.PBKDF2Opts{
+			SaltSize:       16,
+			IterationCount: pbkdf2Iterations,
+			HMACHash:       crypto.SHA256,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encrypt private key")
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
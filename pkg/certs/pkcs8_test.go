@@ -0,0 +1,71 @@
+package certs
+
+import (
+	"crypto"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/youmark/pkcs8"
+)
+
+func TestEncryptKey(t *testing.T) {
+	t.Parallel()
+
+	ca, err := NewCA()
+	assert.NoError(t, err)
+	_, key, err := ca.Issue(WithHosts("webhook.default.svc"))
+	assert.NoError(t, err)
+
+	_, err = EncryptKey(key, "")
+	assert.Error(t, err)
+
+	encrypted, err := EncryptKey(key, "passphrase")
+	assert.NoError(t, err)
+	block, _ := pem.Decode(encrypted)
+	assert.Equal(t, "ENCRYPTED PRIVATE KEY", block.Type)
+
+	_, err = pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte("wrong"))
+	assert.Error(t, err)
+	decrypted, err := pkcs8.ParsePKCS8PrivateKey(block.Bytes, []byte("passphrase"))
+	assert.NoError(t, err)
+	signer, err := parseKey(key)
+	assert.NoError(t, err)
+	assert.Equal(t, signer.Public(), decrypted.(crypto.Signer).Public())
+}
+
+// TestEncryptKeyOpenSSL decrypts the key with openssl, which does not share code with the encoder.
+func TestEncryptKeyOpenSSL(t *testing.T) {
+	t.Parallel()
+
+	if _, err := exec.LookPath("openssl"); err != nil {
+		t.Skip("openssl is not installed")
+	}
+	ca, err := NewCA()
+	assert.NoError(t, err)
+	_, key, err := ca.Issue(WithHosts("webhook.default.svc"))
+	assert.NoError(t, err)
+	encrypted, err := EncryptKey(key, "passphrase")
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "key.enc")
+	assert.NoError(t, os.WriteFile(file, encrypted, 0o600))
+
+	assert.Error(t, exec.Command("openssl", "pkcs8", "-in", file, "-passin", "pass:wrong").Run())
+	decrypted, err := exec.Command("openssl", "pkcs8", "-in", file, "-passin", "pass:passphrase").Output()
+	assert.NoError(t, err)
+	block, _ := pem.Decode(decrypted)
+	assert.Equal(t, "PRIVATE KEY", block.Type)
+	signer, err := parseKey(key)
+	assert.NoError(t, err)
+	want, err := parseKey(pem.EncodeToMemory(block))
+	assert.NoError(t, err)
+	assert.Equal(t, signer.Public(), want.Public())
+
+	params, err := exec.Command("openssl", "asn1parse", "-in", file).Output()
+	assert.NoError(t, err)
+	assert.Contains(t, string(params), "aes-256-cbc")
+	assert.Contains(t, string(params), "hmacWithSHA256")
+}
@@ -0,0 +1,75 @@
+package certs
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VerifyChain checks that the first certificate of the PEM encoded cert chains up to a certificate of the PEM
+// encoded ca. Any further certificates in cert are used as intermediates. Validity periods are not checked.
+func VerifyChain(ca, cert []byte) error {
+	roots, err := ParseCertificates(ca)
+	if err != nil {
+		return errors.Wrap(err, "invalid ca")
+	}
+	chain, err := ParseCertificates(cert)
+	if err != nil {
+		return errors.Wrap(err, "invalid certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		CurrentTime:   chain[0].NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, c := range roots {
+		opts.Roots.AddCert(c)
+	}
+	for _, c := range chain[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+
+	if _, err := chain[0].Verify(opts); err != nil {
+		return errors.Wrap(err, "certificate does not chain to ca")
+	}
+	return nil
+}
+
+// CompareHosts compares the SANs of cert with the comma-separated hosts. It returns the hosts missing from the
+// certificate and the SANs of the certificate that are not in hosts.
+func CompareHosts(cert *x509.Certificate, host string) (missing, unexpected []string) {
+	hosts, err := NormalizeHosts(strings.Split(host, ","))
+	if err != nil {
+		hosts = strings.Split(host, ",")
+	}
+	want := map[string]bool{}
+	for _, h := range hosts {
+		want[h] = true
+	}
+
+	have := map[string]bool{}
+	for _, name := range cert.DNSNames {
+		have[name] = true
+	}
+	for _, ip := range cert.IPAddresses {
+		have[ip.String()] = true
+	}
+	for _, u := range cert.URIs {
+		have[u.String()] = true
+	}
+
+	for h := range want {
+		if !have[h] {
+			missing = append(missing, h)
+		}
+	}
+	for h := range have {
+		if !want[h] {
+			unexpected = append(unexpected, h)
+		}
+	}
+	return missing, unexpected
+}
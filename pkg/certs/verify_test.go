@@ -0,0 +1,39 @@
+package certs
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyChain(t *testing.T) {
+	t.Parallel()
+
+	ca, cert, _, err := GenerateCerts("localhost")
+	assert.NoError(t, err)
+	otherCa, _, _, err := GenerateCerts("localhost")
+	assert.NoError(t, err)
+
+	assert.NoError(t, VerifyChain(ca, cert))
+	assert.Error(t, VerifyChain(otherCa, cert))
+	assert.Error(t, VerifyChain(ca, []byte("invalid")))
+}
+
+func TestCompareHosts(t *testing.T) {
+	t.Parallel()
+
+	_, cert, _, err := GenerateCerts("localhost,example.com,127.0.0.1")
+	assert.NoError(t, err)
+	leaf, err := ParseCertificates(cert)
+	assert.NoError(t, err)
+
+	missing, unexpected := CompareHosts(leaf[0], "127.0.0.1,localhost,example.com")
+	assert.Empty(t, missing)
+	assert.Empty(t, unexpected)
+
+	missing, unexpected = CompareHosts(leaf[0], "localhost,other.com")
+	sort.Strings(unexpected)
+	assert.Equal(t, []string{"other.com"}, missing)
+	assert.Equal(t, []string{"127.0.0.1", "example.com"}, unexpected)
+}
@@ -0,0 +1,437 @@
+package config
+
+import (
+	"crypto/x509/pkix"
+	_ "embed"
+	"os"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+)
+
+// Schema is the JSON schema of the configuration file.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Default values of optional fields.
+const (
+	DefaultCAName                       = "ca.crt"
+	DefaultCertName                     = "cert"
+	DefaultKeyName                      = "key"
+	DefaultAdmissionRegistrationVersion = "v1"
+	DefaultTLSCertName                  = "tls.crt"
+	DefaultTLSKeyName                   = "tls.key"
+	DefaultClusterDomain                = "cluster.local"
+	DefaultKeystoreName                 = "keystore.p12"
+	DefaultKeystorePasswordName         = "keystore.password"
+)
+
+// Secret types. kubernetes.io/tls secrets store the cert and key under tls.crt and tls.key.
+const (
+	SecretTypeOpaque = "Opaque"
+	SecretTypeTLS    = "kubernetes.io/tls"
+)
+
+// Formats of truststores. JKS truststores can be read by Java versions without support for AES encrypted PKCS #12.
+const (
+	TruststoreFormatPKCS12 = "pkcs12"
+	TruststoreFormatJKS    = "jks"
+)
+
+// Certificates of the ca patched into caBundles.
+const (
+	CABundleRoot  = "root"
+	CABundleChain = "chain"
+)
+
+// maxCommonNameLength is the upper bound of the common name in RFC 5280.
+const maxCommonNameLength = 64
+
+// Config lists the certificates managed by certgen and the objects patched with their ca.
+type Config struct {
+	// Namespace is the default namespace of the certificate secrets.
+	Namespace    string        `json:"namespace,omitempty"`
+	Certificates []Certificate `json:"certificates,omitempty"`
+	// SharedCA signs every certificate with one ca, which is configured by the first certificate and constrained to
+	// the hosts of all of them, so that a single caBundle fits every webhook.
+	SharedCA bool `json:"sharedCA,omitempty"`
+	// ClusterDomain is the domain of the cluster that host templates can use.
+	ClusterDomain string `json:"clusterDomain,omitempty"`
+}
+
+// Certificate describes a secret holding a ca, cert and key, and the objects to patch with the ca.
+type Certificate struct {
+	SecretName string   `json:"secretName,omitempty"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Hosts      []string `json:"hosts,omitempty"`
+	CAName     string   `json:"caName,omitempty"`
+	CertName   string   `json:"certName,omitempty"`
+	KeyName    string   `json:"keyName,omitempty"`
+	Patch      Patch    `json:"patch,omitempty"`
+
+	// NameConstraints limits the ca to issuing certificates for Hosts.
+	NameConstraints bool `json:"nameConstraints,omitempty"`
+	// Intermediate generates a root ca signing an intermediate ca, which signs the certificate. The secret stores
+	// the intermediate followed by the root as ca, and the certificate followed by the intermediate as cert.
+	Intermediate bool `json:"intermediate,omitempty"`
+	// Signer is an existing ca signing the certificate instead of a generated one.
+	Signer *Signer `json:"signer,omitempty"`
+	// Client is a client certificate issued by the same ca, e.g. for the API server to authenticate to the webhook.
+	Client *Client `json:"client,omitempty"`
+	// Keystore adds the cert and key to the secret as a PKCS #12 keystore, e.g. for Java webhooks.
+	Keystore *Keystore `json:"keystore,omitempty"`
+	// EncryptedKey adds the key to the secret encrypted with a passphrase.
+	EncryptedKey *EncryptedKey `json:"encryptedKey,omitempty"`
+	// Subject and CASubject are the subjects of the certificate and the ca. The common name of the certificate
+	// defaults to its first host, and the one of the ca to the secret name with a -ca suffix.
+	Subject   Subject `json:"subject,omitempty"`
+	CASubject Subject `json:"caSubject,omitempty"`
+
+	// Type, Labels, Annotations and OwnerReference apply to the secret when it is created.
+	Type           string            `json:"type,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+	OwnerReference *OwnerReference   `json:"ownerReference,omitempty"`
+}
+
+// Subject is the distinguished name of a certificate.
+type Subject struct {
+	CommonName         string   `json:"commonName,omitempty"`
+	Organization       []string `json:"organization,omitempty"`
+	OrganizationalUnit []string `json:"organizationalUnit,omitempty"`
+	Country            []string `json:"country,omitempty"`
+	Province           []string `json:"province,omitempty"`
+	Locality           []string `json:"locality,omitempty"`
+}
+
+// Name returns the subject as a pkix.Name.
+func (s *Subject) Name() pkix.Name {
+	return pkix.Name{
+		CommonName:         s.CommonName,
+		Organization:       s.Organization,
+		OrganizationalUnit: s.OrganizationalUnit,
+		Country:            s.Country,
+		Province:           s.Province,
+		Locality:           s.Locality,
+	}
+}
+
+// Client is a client certificate stored in its own secret, in the namespace and with the keys, type and metadata
+// of the secret of the certificate. The common name and organizations of its subject are the user name and groups
+// the client authenticates as.
+type Client struct {
+	SecretName string  `json:"secretName,omitempty"`
+	Subject    Subject `json:"subject"`
+}
+
+// Keystore stores the cert, its chain up to the root and the key in the secret as a PKCS #12 keystore under Name,
+// and the ca as a truststore in TruststoreFormat under TruststoreName if set. Both are protected by the password in
+// PasswordSecret, or else by a password generated once and stored in the secret under PasswordName.
+type Keystore struct {
+	Name             string     `json:"name,omitempty"`
+	TruststoreName   string     `json:"truststoreName,omitempty"`
+	TruststoreFormat string     `json:"truststoreFormat,omitempty"`
+	PasswordSecret   *SecretKey `json:"passwordSecret,omitempty"`
+	PasswordName     string     `json:"passwordName,omitempty"`
+}
+
+// EncryptedKey stores the key in the secret under Name as a PKCS #8 ENCRYPTED PRIVATE KEY, encrypted with the
+// passphrase in PassphraseSecret or else read from PassphraseFile. Name defaults to the key name with a .enc suffix.
+type EncryptedKey struct {
+	Name             string     `json:"name,omitempty"`
+	PassphraseSecret *SecretKey `json:"passphraseSecret,omitempty"`
+	PassphraseFile   string     `json:"passphraseFile,omitempty"`
+}
+
+// SecretKey selects a key of a secret in the namespace of the certificate.
+type SecretKey struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// Signer locates the PEM encoded certificate and key of a ca. The certificate may be followed by its issuers up to
+// the root, e.g. for an intermediate whose root is kept offline.
+type Signer struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// OwnerReference identifies the object owning a secret, which is garbage collected with its owner.
+type OwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+}
+
+// Patch describes the objects whose caBundle is patched with the ca of a certificate.
+type Patch struct {
+	WebhookName                  string   `json:"webhookName,omitempty"`
+	Validating                   *bool    `json:"validating,omitempty"`
+	Mutating                     *bool    `json:"mutating,omitempty"`
+	FailurePolicy                string   `json:"failurePolicy,omitempty"`
+	AdmissionRegistrationVersion string   `json:"admissionRegistrationVersion,omitempty"`
+	CRDs                         []string `json:"crds,omitempty"`
+	CRDAPIGroups                 []string `json:"crdAPIGroups,omitempty"`
+	APIServices                  []string `json:"apiServices,omitempty"`
+	// CABundle selects the certificates of the ca to patch: the root only, or the chain including intermediates.
+	CABundle string `json:"caBundle,omitempty"`
+}
+
+// Load reads a YAML or JSON configuration file. Unknown fields are rejected.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading config file")
+	}
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, errors.Wrapf(err, "error parsing config file %s", path)
+	}
+	return c, nil
+}
+
+// SetDefaults fills in the optional fields of every certificate that are not set.
+func (c *Config) SetDefaults() {
+	setDefault(&c.ClusterDomain, DefaultClusterDomain)
+	for i := range c.Certificates {
+		cert := &c.Certificates[i]
+		setDefault(&cert.Namespace, c.Namespace)
+		setDefault(&cert.CAName, DefaultCAName)
+		if cn := cert.SecretName + "-ca"; cert.SecretName != "" && len(cn) <= maxCommonNameLength {
+			setDefault(&cert.CASubject.CommonName, cn)
+		}
+		if cert.Client != nil && cert.SecretName != "" {
+			setDefault(&cert.Client.SecretName, cert.SecretName+"-client")
+		}
+		if cert.Keystore != nil {
+			setDefault(&cert.Keystore.Name, DefaultKeystoreName)
+			setDefault(&cert.Keystore.TruststoreFormat, TruststoreFormatPKCS12)
+			if cert.Keystore.PasswordSecret == nil {
+				setDefault(&cert.Keystore.PasswordName, DefaultKeystorePasswordName)
+			}
+		}
+		setDefault(&cert.Type, SecretTypeOpaque)
+		if cert.Type == SecretTypeTLS {
+			setDefault(&cert.CertName, DefaultTLSCertName)
+			setDefault(&cert.KeyName, DefaultTLSKeyName)
+		}
+		setDefault(&cert.CertName, DefaultCertName)
+		setDefault(&cert.KeyName, DefaultKeyName)
+		if cert.EncryptedKey != nil {
+			setDefault(&cert.EncryptedKey.Name, cert.KeyName+".enc")
+		}
+		setDefault(&cert.Patch.AdmissionRegistrationVersion, DefaultAdmissionRegistrationVersion)
+		setDefault(&cert.Patch.CABundle, CABundleRoot)
+		if cert.Patch.Validating == nil {
+			cert.Patch.Validating = boolPtr(true)
+		}
+		if cert.Patch.Mutating == nil {
+			cert.Patch.Mutating = boolPtr(true)
+		}
+	}
+}
+
+// Validate checks that every certificate names a secret, that no secret is listed twice and that the secret and
+// patch settings are valid.
+func (c *Config) Validate() error {
+	seen := map[string]bool{}
+	for i := range c.Certificates {
+		cert := &c.Certificates[i]
+		if cert.SecretName == "" {
+			return errors.Errorf("certificates[%d]: secretName is required", i)
+		}
+		key := cert.Namespace + "/" + cert.SecretName
+		if seen[key] {
+			return errors.Errorf("certificates[%d]: secret %s is listed more than once", i, key)
+		}
+		seen[key] = true
+		if _, err := certs.ParseHosts(cert.Hosts...); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.validateSecret(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.validateSigner(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.validateClient(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.validateKeystore(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.validateEncryptedKey(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.validateSecretKeys(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if err := cert.Patch.Validate(); err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		if c.SharedCA && !c.Certificates[0].sameCA(cert) {
+			return errors.Errorf("certificates[%d]: certificates sharing a ca must agree on intermediate, signer and nameConstraints", i)
+		}
+	}
+	return nil
+}
+
+// sameCA reports whether c and other configure the same kind of ca.
+func (c *Certificate) sameCA(other *Certificate) bool {
+	if (c.Signer == nil) != (other.Signer == nil) || c.Signer != nil && *c.Signer != *other.Signer {
+		return false
+	}
+	return c.Intermediate == other.Intermediate && c.NameConstraints == other.NameConstraints
+}
+
+func (c *Certificate) validateSecret() error {
+	switch c.Type {
+	case "", SecretTypeOpaque:
+	case SecretTypeTLS:
+		if c.CertName != DefaultTLSCertName || c.KeyName != DefaultTLSKeyName {
+			return errors.Errorf("%s secrets must store the cert in %s and the key in %s", SecretTypeTLS, DefaultTLSCertName, DefaultTLSKeyName)
+		}
+	default:
+		return errors.Errorf("secret type %s is not supported", c.Type)
+	}
+	if len(c.Subject.CommonName) > maxCommonNameLength || len(c.CASubject.CommonName) > maxCommonNameLength {
+		return errors.Errorf("common names must not be longer than %d characters", maxCommonNameLength)
+	}
+	if o := c.OwnerReference; o != nil && (o.APIVersion == "" || o.Kind == "" || o.Name == "" || o.UID == "") {
+		return errors.New("ownerReference requires apiVersion, kind, name and uid")
+	}
+	return nil
+}
+
+func (c *Certificate) validateClient() error {
+	if c.Client == nil {
+		return nil
+	}
+	if c.Client.Subject.CommonName == "" {
+		return errors.New("client requires a subject commonName")
+	}
+	if len(c.Client.Subject.CommonName) > maxCommonNameLength {
+		return errors.Errorf("common names must not be longer than %d characters", maxCommonNameLength)
+	}
+	if c.Client.SecretName == c.SecretName {
+		return errors.New("client secretName must differ from secretName")
+	}
+	return nil
+}
+
+func (c *Certificate) validateKeystore() error {
+	k := c.Keystore
+	if k == nil {
+		return nil
+	}
+	switch k.TruststoreFormat {
+	case "", TruststoreFormatPKCS12, TruststoreFormatJKS:
+	default:
+		return errors.Errorf("keystore truststoreFormat %s is not valid", k.TruststoreFormat)
+	}
+	if p := k.PasswordSecret; p != nil {
+		if p.Name == "" || p.Key == "" {
+			return errors.New("keystore passwordSecret requires name and key")
+		}
+		if k.PasswordName != "" {
+			return errors.New("keystore passwordName cannot be combined with passwordSecret")
+		}
+	}
+	return nil
+}
+
+func (c *Certificate) validateEncryptedKey() error {
+	e := c.EncryptedKey
+	if e == nil {
+		return nil
+	}
+	if (e.PassphraseSecret == nil) == (e.PassphraseFile == "") {
+		return errors.New("encryptedKey requires either passphraseSecret or passphraseFile")
+	}
+	if p := e.PassphraseSecret; p != nil && (p.Name == "" || p.Key == "") {
+		return errors.New("encryptedKey passphraseSecret requires name and key")
+	}
+	return nil
+}
+
+// validateSecretKeys checks that the keys of the secret are distinct.
+func (c *Certificate) validateSecretKeys() error {
+	keys := []string{c.CAName, c.CertName, c.KeyName}
+	if k := c.Keystore; k != nil {
+		keys = append(keys, k.Name, k.TruststoreName, k.PasswordName)
+	}
+	if e := c.EncryptedKey; e != nil {
+		keys = append(keys, e.Name)
+	}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if seen[key] {
+			return errors.Errorf("key %s is used more than once in the secret", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func (c *Certificate) validateSigner() error {
+	if c.Signer == nil {
+		return nil
+	}
+	if c.Signer.CertFile == "" || c.Signer.KeyFile == "" {
+		return errors.New("signer requires certFile and keyFile")
+	}
+	if c.Intermediate || c.NameConstraints {
+		return errors.New("signer cannot be combined with intermediate or nameConstraints")
+	}
+	return nil
+}
+
+// Validate checks the failure policy, the caBundle and that at least one kind of webhook is patched.
+func (p *Patch) Validate() error {
+	if p.WebhookName != "" && !p.PatchValidating() && !p.PatchMutating() {
+		return errors.New("validating=false, mutating=false. You must patch at least one kind of webhook")
+	}
+	switch p.CABundle {
+	case "", CABundleRoot, CABundleChain:
+	default:
+		return errors.Errorf("caBundle %s is not valid", p.CABundle)
+	}
+	switch p.FailurePolicy {
+	case "", "Ignore", "Fail":
+		return nil
+	default:
+		return errors.Errorf("failurePolicy %s is not valid", p.FailurePolicy)
+	}
+}
+
+// PatchValidating reports whether ValidatingWebhookConfigurations are patched. It defaults to true.
+func (p *Patch) PatchValidating() bool {
+	return p.Validating == nil || *p.Validating
+}
+
+// PatchMutating reports whether MutatingWebhookConfigurations are patched. It defaults to true.
+func (p *Patch) PatchMutating() bool {
+	return p.Mutating == nil || *p.Mutating
+}
+
+// Empty reports whether no object is patched at all.
+func (p *Patch) Empty() bool {
+	return p.WebhookName == "" && len(p.CRDs) == 0 && len(p.CRDAPIGroups) == 0 && len(p.APIServices) == 0
+}
+
+func setDefault(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadYAML(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, "config.yaml", `
+namespace: default
+certificates:
+- secretName: webhook-a
+  hosts: [a.default.svc]
+  patch:
+    webhookName: a
+    mutating: false
+    crds: [widgets.example.com]
+- secretName: webhook-b
+  namespace: other
+  hosts: [b.other.svc]
+  patch:
+    apiServices: [v1.example.com]
+`)
+	c, err := Load(path)
+	assert.NoError(t, err)
+	c.SetDefaults()
+	assert.NoError(t, c.Validate())
+
+	assert.Len(t, c.Certificates, 2)
+	a, b := c.Certificates[0], c.Certificates[1]
+	assert.Equal(t, "default", a.Namespace)
+	assert.Equal(t, DefaultCAName, a.CAName)
+	assert.True(t, a.Patch.PatchValidating())
+	assert.False(t, a.Patch.PatchMutating())
+	assert.Equal(t, []string{"widgets.example.com"}, a.Patch.CRDs)
+	assert.Equal(t, "other", b.Namespace)
+	assert.Equal(t, []string{"v1.example.com"}, b.Patch.APIServices)
+}
+
+func TestTLSSecretDefaults(t *testing.T) {
+	t.Parallel()
+
+	c := Config{Namespace: "ns", Certificates: []Certificate{
+		{SecretName: "a", Type: SecretTypeTLS, EncryptedKey: &EncryptedKey{PassphraseFile: "/passphrase"}},
+		{SecretName: "b", Client: &Client{Subject: Subject{CommonName: "kube-apiserver"}}},
+		{SecretName: "c", Keystore: &Keystore{}},
+		{SecretName: "d", Keystore: &Keystore{PasswordSecret: &SecretKey{Name: "password", Key: "password"}}},
+	}}
+	c.SetDefaults()
+	assert.NoError(t, c.Validate())
+
+	assert.Equal(t, DefaultTLSCertName, c.Certificates[0].CertName)
+	assert.Equal(t, DefaultTLSKeyName, c.Certificates[0].KeyName)
+	assert.Equal(t, "tls.key.enc", c.Certificates[0].EncryptedKey.Name)
+	assert.Equal(t, SecretTypeOpaque, c.Certificates[1].Type)
+	assert.Equal(t, "b-ca", c.Certificates[1].CASubject.CommonName)
+	assert.Equal(t, "b-client", c.Certificates[1].Client.SecretName)
+	assert.Equal(t, DefaultCertName, c.Certificates[1].CertName)
+	assert.Equal(t, &Keystore{
+		Name:             DefaultKeystoreName,
+		TruststoreFormat: TruststoreFormatPKCS12,
+		PasswordName:     DefaultKeystorePasswordName,
+	}, c.Certificates[2].Keystore)
+	assert.Empty(t, c.Certificates[3].Keystore.PasswordName)
+}
+
+func TestLoadJSONRejectsUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	_, err := Load(writeConfig(t, "config.json", `{"certificates": [{"secretName": "a", "host": "a"}]}`))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	for name, c := range map[string]Config{
+		"missing secret name": {Namespace: "ns", Certificates: []Certificate{{}}},
+		"duplicate secret":    {Namespace: "ns", Certificates: []Certificate{{SecretName: "a"}, {SecretName: "a"}}},
+		"invalid policy":      {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Patch: Patch{FailurePolicy: "fail"}}}},
+		"malformed host":      {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Hosts: []string{"webhook..svc"}}}},
+		"invalid type":        {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Type: "tls"}}},
+		"tls cert name":       {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Type: SecretTypeTLS, CertName: "cert"}}},
+		"long common name": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName: "a",
+			Subject:    Subject{CommonName: strings.Repeat("a", 65)},
+		}}},
+		"invalid ca bundle":  {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Patch: Patch{CABundle: "all"}}}},
+		"signer without key": {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Signer: &Signer{CertFile: "ca.crt"}}}},
+		"signer intermediate": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName:   "a",
+			Intermediate: true,
+			Signer:       &Signer{CertFile: "ca.crt", KeyFile: "ca.key"},
+		}}},
+		"client without name":              {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Client: &Client{}}}},
+		"keystore replacing the key":       {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", Keystore: &Keystore{Name: "key"}}}},
+		"encrypted key without passphrase": {Namespace: "ns", Certificates: []Certificate{{SecretName: "a", EncryptedKey: &EncryptedKey{}}}},
+		"encrypted key with two passphrases": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName:   "a",
+			EncryptedKey: &EncryptedKey{PassphraseFile: "/passphrase", PassphraseSecret: &SecretKey{Name: "passphrase", Key: "passphrase"}},
+		}}},
+		"encrypted key replacing the keystore": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName:   "a",
+			Keystore:     &Keystore{},
+			EncryptedKey: &EncryptedKey{Name: DefaultKeystoreName, PassphraseFile: "/passphrase"},
+		}}},
+		"invalid truststore format": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName: "a",
+			Keystore:   &Keystore{TruststoreFormat: "pem"},
+		}}},
+		"keystore password without key": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName: "a",
+			Keystore:   &Keystore{PasswordSecret: &SecretKey{Name: "password"}},
+		}}},
+		"shared ca with different signers": {Namespace: "ns", SharedCA: true, Certificates: []Certificate{
+			{SecretName: "a"},
+			{SecretName: "b", Signer: &Signer{CertFile: "ca.crt", KeyFile: "ca.key"}},
+		}},
+		"owner without uid": {Namespace: "ns", Certificates: []Certificate{{
+			SecretName:     "a",
+			OwnerReference: &OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "webhook"},
+		}}},
+	} {
+		c := c
+		c.SetDefaults()
+		assert.Error(t, c.Validate(), name)
+	}
+}
+
+// TestSchemaMatchesTypes makes sure the published schema documents exactly the fields of the Go types.
+func TestSchemaMatchesTypes(t *testing.T) {
+	t.Parallel()
+
+	var schema struct {
+		Properties  map[string]json.RawMessage `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"definitions"`
+	}
+	assert.NoError(t, json.Unmarshal(Schema, &schema))
+
+	assert.Equal(t, jsonFields(reflect.TypeOf(Config{})), keys(schema.Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(Certificate{})), keys(schema.Definitions["certificate"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(Patch{})), keys(schema.Definitions["patch"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(OwnerReference{})), keys(schema.Definitions["ownerReference"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(Subject{})), keys(schema.Definitions["subject"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(Signer{})), keys(schema.Definitions["signer"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(Client{})), keys(schema.Definitions["client"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(Keystore{})), keys(schema.Definitions["keystore"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(EncryptedKey{})), keys(schema.Definitions["encryptedKey"].Properties))
+	assert.Equal(t, jsonFields(reflect.TypeOf(SecretKey{})), keys(schema.Definitions["secretKey"].Properties))
+}
+
+func jsonFields(t reflect.Type) []string {
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		fields = append(fields, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func keys(m map[string]json.RawMessage) []string {
+	var k []string
+	for key := range m {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+)
+
+// ExpandHosts resolves the templates in the hosts of every certificate, so that the same hosts work in any
+// namespace. A host can use {{ .Namespace }} and {{ .SecretName }} of its certificate and {{ .ClusterDomain }},
+// e.g. webhook.{{ .Namespace }}.svc.{{ .ClusterDomain }}, as well as environment variables such as
+// ${POD_NAMESPACE}. Unknown fields and variables that are not set are errors.
+func (c *Config) ExpandHosts() error {
+	for i := range c.Certificates {
+		cert := &c.Certificates[i]
+		data := map[string]string{"ClusterDomain": c.ClusterDomain}
+		if cert.Namespace != "" {
+			data["Namespace"] = cert.Namespace
+		}
+		if cert.SecretName != "" {
+			data["SecretName"] = cert.SecretName
+		}
+		for j, host := range cert.Hosts {
+			expanded, err := expandHost(host, data)
+			if err != nil {
+				return errors.Wrapf(err, "certificates[%d]: error expanding host '%s'", i, host)
+			}
+			cert.Hosts[j] = expanded
+		}
+	}
+	return nil
+}
+
+// NormalizeHosts normalizes the hosts of every certificate with certs.NormalizeHosts.
+func (c *Config) NormalizeHosts() error {
+	for i := range c.Certificates {
+		hosts, err := certs.NormalizeHosts(c.Certificates[i].Hosts)
+		if err != nil {
+			return errors.Wrapf(err, "certificates[%d]", i)
+		}
+		c.Certificates[i].Hosts = hosts
+	}
+	return nil
+}
+
+func expandHost(host string, data map[string]string) (string, error) {
+	if strings.Contains(host, "{{") {
+		t, err := template.New("host").Option("missingkey=error").Parse(host)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid template")
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return "", errors.Wrap(err, "invalid template")
+		}
+		host = b.String()
+	}
+
+	var missing []string
+	host = os.Expand(host, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", errors.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return host, nil
+}
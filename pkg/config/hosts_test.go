@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExpandHosts cannot run in parallel because it sets an environment variable.
+func TestExpandHosts(t *testing.T) {
+	t.Setenv("CERTGEN_TEST_TRUST_DOMAIN", "example.org")
+
+	c := Config{ClusterDomain: "cluster.example", Certificates: []Certificate{{
+		SecretName: "webhook-certs",
+		Namespace:  "team-a",
+		Hosts: []string{
+			"webhook.{{ .Namespace }}.svc.{{ .ClusterDomain }}",
+			"{{ .SecretName }}.{{ .Namespace }}.svc",
+			"spiffe://${CERTGEN_TEST_TRUST_DOMAIN}/ns/team-a",
+			"10.0.0.1",
+		},
+	}}}
+	assert.NoError(t, c.ExpandHosts())
+	assert.Equal(t, []string{
+		"webhook.team-a.svc.cluster.example",
+		"webhook-certs.team-a.svc",
+		"spiffe://example.org/ns/team-a",
+		"10.0.0.1",
+	}, c.Certificates[0].Hosts)
+}
+
+func TestExpandHostsErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, host := range []string{
+		"webhook.{{ .Namespace }}.svc",
+		"webhook.{{ .Unknown }}.svc",
+		"webhook.{{ .Namespace .svc",
+		"webhook.${CERTGEN_TEST_UNSET_VARIABLE}.svc",
+	} {
+		c := Config{Certificates: []Certificate{{SecretName: "a", Hosts: []string{host}}}}
+		assert.Error(t, c.ExpandHosts(), host)
+	}
+}
+
+func TestNormalizeHosts(t *testing.T) {
+	t.Parallel()
+
+	c := Config{Certificates: []Certificate{{SecretName: "a", Hosts: []string{" A.default.svc", "", "a.default.svc"}}}}
+	assert.NoError(t, c.NormalizeHosts())
+	assert.Equal(t, []string{"a.default.svc"}, c.Certificates[0].Hosts)
+
+	c.Certificates[0].Hosts = []string{"a..svc"}
+	assert.Error(t, c.NormalizeHosts())
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Checker reports an error when the component it checks is not healthy.
+type Checker func() error
+
+// Health aggregates named liveness and readiness checks and serves them over HTTP.
+type Health struct {
+	mu        sync.RWMutex
+	liveness  map[string]Checker
+	readiness map[string]Checker
+}
+
+// New returns a Health without any checks registered. With no checks, both probes succeed.
+func New() *Health {
+	return &Health{
+		liveness:  map[string]Checker{},
+		readiness: map[string]Checker{},
+	}
+}
+
+// AddLivenessCheck registers a check served by the liveness handler.
+func (h *Health) AddLivenessCheck(name string, check Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness[name] = check
+}
+
+// AddReadinessCheck registers a check served by the readiness handler.
+func (h *Health) AddReadinessCheck(name string, check Checker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness[name] = check
+}
+
+// LivenessHandler returns an http.Handler suitable for a /healthz endpoint.
+func (h *Health) LivenessHandler() http.Handler {
+	return h.handler(func() map[string]Checker { return h.liveness })
+}
+
+// ReadinessHandler returns an http.Handler suitable for a /readyz endpoint.
+func (h *Health) ReadinessHandler() http.Handler {
+	return h.handler(func() map[string]Checker { return h.readiness })
+}
+
+func (h *Health) handler(checks func() map[string]Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+
+		registered := checks()
+		names := make([]string, 0, len(registered))
+		for name := range registered {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		status := http.StatusOK
+		body := ""
+		for _, name := range names {
+			if err := registered[name](); err != nil {
+				status = http.StatusServiceUnavailable
+				body += fmt.Sprintf("[-]%s failed: %v\n", name, err)
+				continue
+			}
+			body += fmt.Sprintf("[+]%s ok\n", name)
+		}
+		if status == http.StatusOK {
+			body += "ok\n"
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = fmt.Fprint(w, body)
+	})
+}
+
+// Reconcile tracks the result of the most recent reconcile. Its Check method fails until a
+// reconcile has completed and whenever the last one failed.
+type Reconcile struct {
+	mu   sync.RWMutex
+	done bool
+	err  error
+}
+
+// Observe records the result of a reconcile.
+func (r *Reconcile) Observe(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	r.err = err
+}
+
+// Check implements Checker.
+func (r *Reconcile) Check() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.done {
+		return errors.New("no reconcile completed yet")
+	}
+	if r.err != nil {
+		return errors.Wrap(r.err, "last reconcile failed")
+	}
+	return nil
+}
+
+// Heartbeat tracks when a loop last completed an iteration. Its Check method fails when that is longer ago than
+// its maximum age, e.g. because the loop is stuck.
+type Heartbeat struct {
+	mu     sync.RWMutex
+	last   time.Time
+	maxAge time.Duration
+}
+
+// NewHeartbeat returns a Heartbeat whose check fails maxAge after it was created or last beat.
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{last: time.Now(), maxAge: maxAge}
+}
+
+// Beat records that the loop completed an iteration.
+func (h *Heartbeat) Beat() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.last = time.Now()
+}
+
+// Check implements Checker.
+func (h *Heartbeat) Check() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if age := time.Since(h.last); age > h.maxAge {
+		return errors.Errorf("no iteration completed for %s", age.Round(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(h http.Handler) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	return rec.Code, rec.Body.String()
+}
+
+func TestHealthWithoutChecks(t *testing.T) {
+	t.Parallel()
+
+	h := New()
+
+	code, body := probe(h.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	code, _ = probe(h.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestReadinessFollowsReconcile(t *testing.T) {
+	t.Parallel()
+
+	h := New()
+	r := &Reconcile{}
+	h.AddReadinessCheck("reconcile", r.Check)
+
+	code, body := probe(h.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "[-]reconcile failed: no reconcile completed yet")
+
+	r.Observe(nil)
+	code, body = probe(h.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "[+]reconcile ok\nok\n", body)
+
+	r.Observe(errors.New("forbidden"))
+	code, body = probe(h.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "last reconcile failed: forbidden")
+
+	code, _ = probe(h.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	h := New()
+	beat := NewHeartbeat(time.Hour)
+	h.AddLivenessCheck("loop", beat.Check)
+	code, _ := probe(h.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+
+	beat.last = time.Now().Add(-2 * time.Hour)
+	code, body := probe(h.LivenessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "[-]loop failed: no iteration completed for 2h0m0s")
+
+	beat.Beat()
+	code, _ = probe(h.LivenessHandler())
+	assert.Equal(t, http.StatusOK, code)
+}
@@ -0,0 +1,183 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/util"
+)
+
+// CABundle is the caBundle currently carried by a single client configuration of a cluster object.
+type CABundle struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Webhook  string `json:"webhook,omitempty"`
+	CABundle []byte `json:"-"`
+}
+
+// GetWebhookCABundles returns the caBundle of every webhook of the ValidatingWebhookConfiguration and
+// MutatingWebhookConfiguration named configurationName.
+func (k8s *K8s) GetWebhookCABundles(
+	ctx context.Context,
+	configurationName string,
+	validating bool,
+	mutating bool,
+	version AdmissionRegistrationVersion,
+) ([]CABundle, error) {
+	var bundles []CABundle
+
+	if validating {
+		b, err := k8s.getValidatingWebhookCABundles(ctx, version, configurationName)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b...)
+	}
+
+	if mutating {
+		b, err := k8s.getMutatingWebhookCABundles(ctx, version, configurationName)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b...)
+	}
+
+	return bundles, nil
+}
+
+func (k8s *K8s) getValidatingWebhookCABundles(ctx context.Context, version AdmissionRegistrationVersion, name string) ([]CABundle, error) {
+	var bundles []CABundle
+
+	switch version {
+	case admissionRegistrationV1beta1:
+		hook, err := k8s.clientset.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, apiError(err, "failed getting admissionregistration.k8s.io/v1beta1 validating webhook")
+		}
+		for i := range hook.Webhooks {
+			bundles = append(bundles, CABundle{
+				Kind:     kindValidatingWebhookConfiguration,
+				Name:     name,
+				Webhook:  hook.Webhooks[i].Name,
+				CABundle: hook.Webhooks[i].ClientConfig.CABundle,
+			})
+		}
+	case admissionRegistrationV1:
+		hook, err := k8s.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, apiError(err, "failed getting admissionregistration.k8s.io/v1 validating webhook")
+		}
+		for i := range hook.Webhooks {
+			bundles = append(bundles, CABundle{
+				Kind:     kindValidatingWebhookConfiguration,
+				Name:     name,
+				Webhook:  hook.Webhooks[i].Name,
+				CABundle: hook.Webhooks[i].ClientConfig.CABundle,
+			})
+		}
+	default:
+		return nil, errors.Errorf("invalid admissionregistration.k8s.io version: %s", version)
+	}
+
+	return bundles, nil
+}
+
+func (k8s *K8s) getMutatingWebhookCABundles(ctx context.Context, version AdmissionRegistrationVersion, name string) ([]CABundle, error) {
+	var bundles []CABundle
+
+	switch version {
+	case admissionRegistrationV1beta1:
+		hook, err := k8s.clientset.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, apiError(err, "failed getting admissionregistration.k8s.io/v1beta1 mutating webhook")
+		}
+		for i := range hook.Webhooks {
+			bundles = append(bundles, CABundle{
+				Kind:     kindMutatingWebhookConfiguration,
+				Name:     name,
+				Webhook:  hook.Webhooks[i].Name,
+				CABundle: hook.Webhooks[i].ClientConfig.CABundle,
+			})
+		}
+	case admissionRegistrationV1:
+		hook, err := k8s.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, apiError(err, "failed getting admissionregistration.k8s.io/v1 mutating webhook")
+		}
+		for i := range hook.Webhooks {
+			bundles = append(bundles, CABundle{
+				Kind:     kindMutatingWebhookConfiguration,
+				Name:     name,
+				Webhook:  hook.Webhooks[i].Name,
+				CABundle: hook.Webhooks[i].ClientConfig.CABundle,
+			})
+		}
+	default:
+		return nil, errors.Errorf("invalid admissionregistration.k8s.io version: %s", version)
+	}
+
+	return bundles, nil
+}
+
+// GetCRDCABundles returns the conversion webhook caBundle of the comma-separated CustomResourceDefinitions and of
+// every CustomResourceDefinition with a conversion webhook in the comma-separated API groups.
+func (k8s *K8s) GetCRDCABundles(ctx context.Context, crds, crdAPIGroups string) ([]CABundle, error) {
+	var bundles []CABundle
+
+	if crds != "" {
+		for _, name := range strings.Split(crds, ",") {
+			crd, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, apiError(err, "error getting CustomResourceDefinition %s", name)
+			}
+			caBundle, _ := conversionCABundle(crd)
+			bundles = append(bundles, CABundle{Kind: kindCustomResourceDefinition, Name: name, CABundle: caBundle})
+		}
+	}
+
+	if crdAPIGroups != "" {
+		list, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, apiError(err, "error listing CustomResourceDefinition objects")
+		}
+		groups := strings.Split(crdAPIGroups, ",")
+		for i := range list.Items {
+			crd := &list.Items[i]
+			if !util.In(groups, crd.Spec.Group) {
+				continue
+			}
+			if caBundle, ok := conversionCABundle(crd); ok {
+				bundles = append(bundles, CABundle{Kind: kindCustomResourceDefinition, Name: crd.Name, CABundle: caBundle})
+			}
+		}
+	}
+
+	return bundles, nil
+}
+
+// conversionCABundle returns the conversion webhook caBundle of crd and whether it has a conversion webhook at all.
+func conversionCABundle(crd *apiextensionsv1.CustomResourceDefinition) ([]byte, bool) {
+	if crd.Spec.Conversion == nil || crd.Spec.Conversion.Webhook == nil || crd.Spec.Conversion.Webhook.ClientConfig == nil {
+		return nil, false
+	}
+	return crd.Spec.Conversion.Webhook.ClientConfig.CABundle, true
+}
+
+// GetAPIServiceCABundles returns the caBundle of the comma-separated APIServices.
+func (k8s *K8s) GetAPIServiceCABundles(ctx context.Context, apiServices string) ([]CABundle, error) {
+	var bundles []CABundle
+
+	for _, name := range strings.Split(apiServices, ",") {
+		apiService, err := k8s.aggregatorClientset.ApiregistrationV1().APIServices().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, apiError(err, "error getting APIService %s", name)
+		}
+		bundles = append(bundles, CABundle{Kind: kindAPIService, Name: name, CABundle: apiService.Spec.CABundle})
+	}
+
+	return bundles, nil
+}
@@ -0,0 +1,111 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	aggregatorfake "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/fake"
+)
+
+func TestGetWebhookCABundles(t *testing.T) {
+	t.Parallel()
+
+	ca := []byte("ca")
+	k := &K8s{
+		clientset: fake.NewSimpleClientset(
+			&admissionv1.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: testWebhookName},
+				Webhooks: []admissionv1.ValidatingWebhook{
+					{Name: "v1", ClientConfig: admissionv1.WebhookClientConfig{CABundle: ca}},
+					{Name: "v2"},
+				},
+			},
+			&admissionv1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: testWebhookName},
+				Webhooks:   []admissionv1.MutatingWebhook{{Name: "m1", ClientConfig: admissionv1.WebhookClientConfig{CABundle: ca}}},
+			},
+		),
+	}
+
+	bundles, err := k.GetWebhookCABundles(context.Background(), testWebhookName, true, true, admissionRegistrationV1)
+	assert.NoError(t, err)
+	assert.Equal(t, []CABundle{
+		{Kind: kindValidatingWebhookConfiguration, Name: testWebhookName, Webhook: "v1", CABundle: ca},
+		{Kind: kindValidatingWebhookConfiguration, Name: testWebhookName, Webhook: "v2"},
+		{Kind: kindMutatingWebhookConfiguration, Name: testWebhookName, Webhook: "m1", CABundle: ca},
+	}, bundles)
+
+	_, err = k.GetWebhookCABundles(context.Background(), "missing", true, false, admissionRegistrationV1)
+	assert.Error(t, err)
+}
+
+func TestGetCRDAndAPIServiceCABundles(t *testing.T) {
+	t.Parallel()
+
+	ca := []byte("ca")
+	withWebhook := func(name, group string) *apiextensionsv1.CustomResourceDefinition {
+		return &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group: group,
+				Conversion: &apiextensionsv1.CustomResourceConversion{
+					Webhook: &apiextensionsv1.WebhookConversion{ClientConfig: &apiextensionsv1.WebhookClientConfig{CABundle: ca}},
+				},
+			},
+		}
+	}
+	k := &K8s{
+		apiserverClientset: apiextensionsfake.NewSimpleClientset(
+			withWebhook("a.example.com", "example.com"),
+			withWebhook("b.other.com", "other.com"),
+			&apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "c.example.com"},
+				Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Group: "example.com"},
+			},
+		),
+		aggregatorClientset: aggregatorfake.NewSimpleClientset(&apiregistrationv1.APIService{
+			ObjectMeta: metav1.ObjectMeta{Name: "v1.example.com"},
+			Spec:       apiregistrationv1.APIServiceSpec{CABundle: ca},
+		}),
+	}
+
+	bundles, err := k.GetCRDCABundles(context.Background(), "b.other.com", "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []CABundle{
+		{Kind: kindCustomResourceDefinition, Name: "b.other.com", CABundle: ca},
+		{Kind: kindCustomResourceDefinition, Name: "a.example.com", CABundle: ca},
+	}, bundles)
+
+	bundles, err = k.GetAPIServiceCABundles(context.Background(), "v1.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []CABundle{{Kind: kindAPIService, Name: "v1.example.com", CABundle: ca}}, bundles)
+}
+
+func TestPatchAPIServices(t *testing.T) {
+	t.Parallel()
+
+	ca := []byte("ca")
+	k := &K8s{
+		aggregatorClientset: aggregatorfake.NewSimpleClientset(
+			&apiregistrationv1.APIService{ObjectMeta: metav1.ObjectMeta{Name: "v1.example.com"}},
+			&apiregistrationv1.APIService{ObjectMeta: metav1.ObjectMeta{Name: "v2.example.com"}},
+		),
+	}
+
+	assert.NoError(t, k.PatchAPIServices(context.Background(), "v1.example.com,v2.example.com", ca))
+
+	bundles, err := k.GetAPIServiceCABundles(context.Background(), "v1.example.com,v2.example.com")
+	assert.NoError(t, err)
+	for _, b := range bundles {
+		assert.Equal(t, ca, b.CABundle)
+	}
+
+	assert.Error(t, k.PatchAPIServices(context.Background(), "missing", ca))
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Kinds of errors returned by K8s. Test for them with errors.Is.
+var (
+	// ErrNotFound is returned when an object does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrForbidden is returned when the credentials are not allowed to access an object.
+	ErrForbidden = errors.New("forbidden")
+	// ErrConflict is returned when an object was created or modified concurrently.
+	ErrConflict = errors.New("conflict")
+	// ErrMalformedSecret is returned when a secret lacks the expected keys.
+	ErrMalformedSecret = errors.New("malformed secret")
+)
+
+// Error is the error returned by K8s. errors.Is matches it against its kind, and errors.As against the
+// underlying Kubernetes API error, e.g. *k8serrors.StatusError.
+type Error struct {
+	msg  string
+	kind error
+	err  error
+}
+
+func (e *Error) Error() string {
+	if e.err == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.err.Error()
+}
+
+// Unwrap returns the underlying Kubernetes API error.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Is reports whether target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	return e.kind != nil && target == e.kind
+}
+
+// apiError wraps an error returned by the Kubernetes API with a message and the matching kind.
+func apiError(err error, format string, args ...any) error {
+	var kind error
+	switch {
+	case k8serrors.IsNotFound(err):
+		kind = ErrNotFound
+	case k8serrors.IsForbidden(err), k8serrors.IsUnauthorized(err):
+		kind = ErrForbidden
+	case k8serrors.IsConflict(err), k8serrors.IsAlreadyExists(err):
+		kind = ErrConflict
+	}
+	return &Error{msg: fmt.Sprintf(format, args...), kind: kind, err: err}
+}
+
+func malformedSecretError(format string, args ...any) error {
+	return &Error{msg: fmt.Sprintf(format, args...), kind: ErrMalformedSecret}
+}
@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestForbiddenError(t *testing.T) {
+	t.Parallel()
+
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, testSecretName, errors.New("denied"))
+	})
+	k := &K8s{clientset: cs}
+
+	_, err := k.GetCaFromSecret(context.Background(), testSecretName, testNamespace, "ca.crt")
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.True(t, k8serrors.IsForbidden(err))
+
+	_, _, _, err = k.GetCertsFromSecret(context.Background(), testSecretName, testNamespace, "ca.crt", "cert", "key")
+	assert.ErrorIs(t, err, ErrForbidden)
+}
+
+func TestMalformedSecretError(t *testing.T) {
+	t.Parallel()
+
+	k := &K8s{clientset: fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testNamespace},
+		Data:       map[string][]byte{"other": []byte("data")},
+	})}
+
+	_, err := k.GetCaFromSecret(context.Background(), testSecretName, testNamespace, "ca.crt")
+	assert.ErrorIs(t, err, ErrMalformedSecret)
+}
+
+func TestConflictError(t *testing.T) {
+	t.Parallel()
+
+	cs := fake.NewSimpleClientset()
+	cs.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, k8serrors.NewAlreadyExists(schema.GroupResource{Resource: "secrets"}, testSecretName)
+	})
+	k := &K8s{clientset: cs}
+	ca, cert, key := genSecretData()
+
+	err := k.SaveCertsToSecret(context.Background(), testSecretName, testNamespace, "ca.crt", "cert", "key", ca, cert, key)
+	assert.ErrorIs(t, err, ErrConflict)
+}
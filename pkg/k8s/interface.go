@@ -0,0 +1,130 @@
+package k8s
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Interface is the set of Kubernetes operations of K8s. Depend on it instead of *K8s to replace the operations in
+// tests.
+type Interface interface {
+	SecretStore
+	CABundlePatcher
+	Locker
+	Pinger
+}
+
+// SecretStore reads and writes certificates in secrets.
+type SecretStore interface {
+	GetCerts(ctx context.Context, ref SecretRef) (*Certs, error)
+	SaveCerts(ctx context.Context, ref SecretRef, certs, observed *Certs, opts ...SecretOption) error
+	GetSecretData(ctx context.Context, namespace, name string) (map[string][]byte, error)
+}
+
+// CABundlePatcher reads and patches the caBundle of the objects selected by PatchOptions.
+type CABundlePatcher interface {
+	GetCABundles(ctx context.Context, opts PatchOptions) ([]CABundle, error)
+	PatchCABundles(ctx context.Context, ca []byte, opts PatchOptions) error
+}
+
+// Locker serializes concurrent runs with a Lease.
+type Locker interface {
+	Lock(ctx context.Context, namespace, name, holder string, duration, wait time.Duration) (context.Context, func(), error)
+}
+
+// Pinger checks that the API server can be reached.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+var _ Interface = (*K8s)(nil)
+
+// PatchOptions selects the objects whose caBundle is patched.
+type PatchOptions struct {
+	// WebhookName is the name of the ValidatingWebhookConfiguration and MutatingWebhookConfiguration to patch.
+	WebhookName string
+	// Validating and Mutating select which kinds of webhook configuration named WebhookName are patched.
+	Validating bool
+	Mutating   bool
+	// FailurePolicy, if set, replaces the failure policy of the webhooks.
+	FailurePolicy string
+	// AdmissionRegistrationVersion is the admissionregistration.k8s.io version to use. It defaults to v1.
+	AdmissionRegistrationVersion AdmissionRegistrationVersion
+
+	// CRDs and CRDAPIGroups select the CustomResourceDefinitions whose conversion webhook is patched by name and
+	// by API group.
+	CRDs         []string
+	CRDAPIGroups []string
+	// APIServices are the names of the APIServices to patch.
+	APIServices []string
+}
+
+func (o *PatchOptions) version() AdmissionRegistrationVersion {
+	if o.AdmissionRegistrationVersion == "" {
+		return admissionRegistrationV1
+	}
+	return o.AdmissionRegistrationVersion
+}
+
+// PatchCABundles patches the caBundle of every object selected by opts with ca.
+func (k8s *K8s) PatchCABundles(ctx context.Context, ca []byte, opts PatchOptions) error {
+	if opts.WebhookName != "" {
+		if err := k8s.PatchWebhookConfigurations(
+			ctx,
+			opts.WebhookName,
+			ca,
+			opts.FailurePolicy,
+			opts.Mutating,
+			opts.Validating,
+			opts.version(),
+		); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.CRDs) > 0 || len(opts.CRDAPIGroups) > 0 {
+		if err := k8s.PatchCustomResourceDefinitions(ctx, strings.Join(opts.CRDs, ","), strings.Join(opts.CRDAPIGroups, ","), ca); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.APIServices) > 0 {
+		if err := k8s.PatchAPIServices(ctx, strings.Join(opts.APIServices, ","), ca); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetCABundles returns the caBundles of every object selected by opts.
+func (k8s *K8s) GetCABundles(ctx context.Context, opts PatchOptions) ([]CABundle, error) {
+	var bundles []CABundle
+
+	if opts.WebhookName != "" {
+		b, err := k8s.GetWebhookCABundles(ctx, opts.WebhookName, opts.Validating, opts.Mutating, opts.version())
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b...)
+	}
+
+	if len(opts.CRDs) > 0 || len(opts.CRDAPIGroups) > 0 {
+		b, err := k8s.GetCRDCABundles(ctx, strings.Join(opts.CRDs, ","), strings.Join(opts.CRDAPIGroups, ","))
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b...)
+	}
+
+	if len(opts.APIServices) > 0 {
+		b, err := k8s.GetAPIServiceCABundles(ctx, strings.Join(opts.APIServices, ","))
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, b...)
+	}
+
+	return bundles, nil
+}
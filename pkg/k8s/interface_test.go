@@ -0,0 +1,205 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admissionregistration/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	aggregatorfake "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset/fake"
+)
+
+func TestSaveThenGetCerts(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+	ctx := context.Background()
+	ref := SecretRef{Namespace: testNamespace, Name: testSecretName}
+
+	missing, err := k.GetCerts(ctx, ref)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+	assert.False(t, missing.Complete())
+
+	ca, cert, key := genSecretData()
+	assert.NoError(t, k.SaveCerts(ctx, ref, &Certs{CA: ca, Cert: cert, Key: key}, missing))
+
+	got, err := k.GetCerts(ctx, ref)
+	assert.NoError(t, err)
+	assert.True(t, got.Complete())
+	assert.Equal(t, &Certs{CA: ca, Cert: cert, Key: key}, got)
+
+	secret, err := k.clientset.CoreV1().Secrets(testNamespace).Get(ctx, testSecretName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, cert, secret.Data[DefaultCertKey])
+}
+
+func TestSaveCertsWithDataThenGetSecretData(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+	ctx := context.Background()
+	ref := SecretRef{Namespace: testNamespace, Name: testSecretName}
+
+	missing, err := k.GetSecretData(ctx, testNamespace, testSecretName)
+	assert.NoError(t, err)
+	assert.Nil(t, missing)
+
+	ca, cert, key := genSecretData()
+	extra := map[string][]byte{"keystore.p12": []byte("store"), DefaultKeyKey: []byte("ignored")}
+	assert.NoError(t, k.SaveCerts(ctx, ref, &Certs{CA: ca, Cert: cert, Key: key}, nil, WithData(extra)))
+
+	data, err := k.GetSecretData(ctx, testNamespace, testSecretName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{DefaultCAKey: ca, DefaultCertKey: cert, DefaultKeyKey: key, "keystore.p12": []byte("store")}, data)
+
+	observed, err := k.GetCerts(ctx, ref)
+	assert.NoError(t, err)
+	extra = map[string][]byte{"keystore.p12": []byte("updated"), DefaultCertKey: []byte("ignored")}
+	assert.NoError(t, k.SaveCerts(ctx, ref, &Certs{CA: ca, Cert: cert, Key: key}, observed, WithData(extra)))
+	data, err = k.GetSecretData(ctx, testNamespace, testSecretName)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("updated"), data["keystore.p12"])
+	assert.Equal(t, cert, data[DefaultCertKey])
+}
+
+func TestSaveCertsWrittenConcurrently(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ref := SecretRef{Namespace: testNamespace, Name: testSecretName}
+	secrets := v1.SchemeGroupVersion.WithResource("secrets")
+	ca, cert, key := genSecretData()
+
+	for name, tc := range map[string]struct {
+		exists  bool
+		deleted bool
+		// write writes the secret of the other run between the read and the save.
+		write func(tracker k8stesting.ObjectTracker, secret *v1.Secret) error
+	}{
+		"created": {
+			write: func(tracker k8stesting.ObjectTracker, secret *v1.Secret) error {
+				return tracker.Create(secrets, secret, testNamespace)
+			},
+		},
+		"updated": {
+			exists: true,
+			write: func(tracker k8stesting.ObjectTracker, secret *v1.Secret) error {
+				return tracker.Update(secrets, secret, testNamespace)
+			},
+		},
+		"deleted": {
+			exists:  true,
+			deleted: true,
+			write: func(tracker k8stesting.ObjectTracker, _ *v1.Secret) error {
+				return tracker.Delete(secrets, testNamespace, testSecretName)
+			},
+		},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cs := fake.NewSimpleClientset()
+			withResourceVersions(cs)
+			k := &K8s{clientset: cs}
+			if tc.exists {
+				assert.NoError(t, k.SaveCerts(ctx, ref, &Certs{CA: ca, Cert: cert, Key: key}, nil))
+			}
+			observed, err := k.GetCerts(ctx, ref)
+			assert.NoError(t, err)
+
+			winner := NewSecret(testSecretName, testNamespace, map[string][]byte{DefaultCAKey: []byte("winner")})
+			winner.ResourceVersion = "winner"
+			written := false
+			cs.PrependReactor("*", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				if action.GetVerb() != "get" && !written {
+					written = true
+					assert.NoError(t, tc.write(cs.Tracker(), winner))
+				}
+				return false, nil, nil
+			})
+
+			err = k.SaveCerts(ctx, ref, &Certs{CA: ca, Cert: cert, Key: key}, observed)
+			assert.ErrorIs(t, err, ErrConflict)
+			assert.True(t, written)
+
+			got, err := k.GetCerts(ctx, ref)
+			assert.NoError(t, err)
+			if tc.deleted {
+				assert.Nil(t, got)
+			} else {
+				assert.Equal(t, []byte("winner"), got.CA)
+			}
+		})
+	}
+}
+
+// withResourceVersions makes cs version secrets like the API server does: writes change the resourceVersion, and
+// updates of another version than the stored one fail with a conflict.
+func withResourceVersions(cs *fake.Clientset) {
+	var version int
+	cs.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		version++
+		action.(k8stesting.CreateAction).GetObject().(*v1.Secret).ResourceVersion = strconv.Itoa(version)
+		return false, nil, nil
+	})
+	cs.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret := action.(k8stesting.UpdateAction).GetObject().(*v1.Secret)
+		stored, err := cs.Tracker().Get(v1.SchemeGroupVersion.WithResource("secrets"), secret.Namespace, secret.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		if stored.(*v1.Secret).ResourceVersion != secret.ResourceVersion {
+			return true, nil, k8serrors.NewConflict(v1.Resource("secrets"), secret.Name, errors.New("the object has been modified"))
+		}
+		version++
+		secret.ResourceVersion = strconv.Itoa(version)
+		return false, nil, nil
+	})
+}
+
+func TestPatchThenGetCABundles(t *testing.T) {
+	t.Parallel()
+
+	k := &K8s{
+		clientset: fake.NewSimpleClientset(
+			&admissionv1.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: testWebhookName},
+				Webhooks:   []admissionv1.ValidatingWebhook{{Name: "v"}},
+			},
+			&admissionv1.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{Name: testWebhookName},
+				Webhooks:   []admissionv1.MutatingWebhook{{Name: "m"}},
+			},
+		),
+		aggregatorClientset: aggregatorfake.NewSimpleClientset(&apiregistrationv1.APIService{
+			ObjectMeta: metav1.ObjectMeta{Name: "v1.example.com"},
+		}),
+	}
+	ctx := context.Background()
+	ca := []byte("ca")
+	opts := PatchOptions{WebhookName: testWebhookName, Validating: true, APIServices: []string{"v1.example.com"}}
+
+	assert.NoError(t, k.PatchCABundles(ctx, ca, opts))
+
+	bundles, err := k.GetCABundles(ctx, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []CABundle{
+		{Kind: kindValidatingWebhookConfiguration, Name: testWebhookName, Webhook: "v", CABundle: ca},
+		{Kind: kindAPIService, Name: "v1.example.com", CABundle: ca},
+	}, bundles)
+
+	mutating, err := k.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, testWebhookName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Nil(t, mutating.Webhooks[0].ClientConfig.CABundle)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 
+	"github.com/kubeshop/kube-webhook-certgen/pkg/metrics"
 	"github.com/kubeshop/kube-webhook-certgen/pkg/util"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -13,11 +14,11 @@ import (
 	admissionv1 "k8s.io/api/admissionregistration/v1"
 	admissionv1beta1 "k8s.io/api/admissionregistration/v1beta1"
 
-	v1 "k8s.io/api/core/v1"
 	apiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
 )
 
@@ -34,6 +35,34 @@ const (
 	admissionRegistrationV1beta1 AdmissionRegistrationVersion = "v1beta1"
 )
 
+const (
+	kindValidatingWebhookConfiguration = "ValidatingWebhookConfiguration"
+	kindMutatingWebhookConfiguration   = "MutatingWebhookConfiguration"
+	kindCustomResourceDefinition       = "CustomResourceDefinition"
+	kindAPIService                     = "APIService"
+)
+
+// NewForConfig returns a K8s using clients created from config.
+func NewForConfig(config *rest.Config) (*K8s, error) {
+	cs, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kubernetes client")
+	}
+
+	aggregatorCS, err := clientset.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kubernetes aggregator client")
+	}
+
+	apiextensionsCS, err := apiextensions.NewForConfig(config)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kubernetes apiextensions client")
+	}
+
+	return New(cs, aggregatorCS, apiextensionsCS)
+}
+
+// New returns a K8s using the given clients.
 func New(cs kubernetes.Interface, aggregatorCS clientset.Interface, apiextensionsCS apiextensions.Interface) (*K8s, error) {
 	if cs == nil {
 		return nil, errors.New("no kubernetes client given")
@@ -83,13 +112,15 @@ func (k8s *K8s) patchCRDs(ctx context.Context, crds string, ca []byte) error {
 	for _, crd := range splitted {
 		obj, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crd, metav1.GetOptions{})
 		if err != nil {
-			return errors.Wrapf(err, "error getting CustomResourceDefinition %s", crd)
+			return apiError(err, "error getting CustomResourceDefinition %s", crd)
 		}
 		if err := setCABundle(obj, ca); err != nil {
 			log.Warnf("skip patching CustomResourceDefinition %s: %v", crd, err)
 		}
-		if _, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, obj, metav1.UpdateOptions{}); err != nil {
-			return errors.Wrapf(err, "error updating CustomResourceDefinition %s", obj.Name)
+		_, err = k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, obj, metav1.UpdateOptions{})
+		metrics.ObservePatch(kindCustomResourceDefinition, err)
+		if err != nil {
+			return apiError(err, "error updating CustomResourceDefinition %s", obj.Name)
 		}
 		log.Infof("patched caBundle for CustomResourceDefinition %s", crd)
 	}
@@ -101,7 +132,7 @@ func (k8s *K8s) patchCRDAPIGroup(ctx context.Context, crdAPIGroups string, ca []
 
 	list, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		return errors.Wrap(err, "error listing CustomResourceDefinition objects")
+		return apiError(err, "error listing CustomResourceDefinition objects")
 	}
 
 	splitted := strings.Split(crdAPIGroups, ",")
@@ -112,8 +143,10 @@ func (k8s *K8s) patchCRDAPIGroup(ctx context.Context, crdAPIGroups string, ca []
 			if err := setCABundle(&crd, ca); err != nil {
 				log.Warnf("skip patching CustomResourceDefinition %s: %v", crd.Name, err)
 			}
-			if _, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, &crd, metav1.UpdateOptions{}); err != nil {
-				return errors.Wrapf(err, "error updating CustomResourceDefinition %s", crd.Name)
+			_, err := k8s.apiserverClientset.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, &crd, metav1.UpdateOptions{})
+			metrics.ObservePatch(kindCustomResourceDefinition, err)
+			if err != nil {
+				return apiError(err, "error updating CustomResourceDefinition %s", crd.Name)
 			}
 			log.Infof("patched caBundle for CustomResourceDefinition %s", crd.Name)
 		}
@@ -135,6 +168,29 @@ func setCABundle(crd *apiextensionsv1.CustomResourceDefinition, ca []byte) error
 	return nil
 }
 
+// PatchAPIServices will patch the caBundle of the comma-separated APIServices with the provided ca data.
+func (k8s *K8s) PatchAPIServices(ctx context.Context, apiServices string, ca []byte) error {
+	log.Infof("patching APIService objects '%s'", apiServices)
+
+	for _, name := range strings.Split(apiServices, ",") {
+		obj, err := k8s.aggregatorClientset.ApiregistrationV1().APIServices().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return apiError(err, "error getting APIService %s", name)
+		}
+		obj.Spec.CABundle = ca
+		_, err = k8s.aggregatorClientset.ApiregistrationV1().APIServices().Update(ctx, obj, metav1.UpdateOptions{})
+		metrics.ObservePatch(kindAPIService, err)
+		if err != nil {
+			return apiError(err, "error updating APIService %s", name)
+		}
+		log.Infof("patched caBundle for APIService %s", name)
+	}
+
+	log.Info("successfully patched APIService(s)")
+
+	return nil
+}
+
 // PatchWebhookConfigurations will patch validatingWebhook and mutatingWebhook clientConfig configurations with
 // the provided ca data. If failurePolicy is provided, patch all webhooks with this value.
 func (k8s *K8s) PatchWebhookConfigurations(
@@ -152,7 +208,9 @@ func (k8s *K8s) PatchWebhookConfigurations(
 	)
 
 	if patchValidating {
-		if err := k8s.patchValidatingWebhookConfiguration(ctx, version, configurationNames, ca, failurePolicy); err != nil {
+		err := k8s.patchValidatingWebhookConfiguration(ctx, version, configurationNames, ca, failurePolicy)
+		metrics.ObservePatch(kindValidatingWebhookConfiguration, err)
+		if err != nil {
 			return err
 		}
 	} else {
@@ -160,7 +218,9 @@ func (k8s *K8s) PatchWebhookConfigurations(
 	}
 
 	if patchMutating {
-		if err := k8s.patchMutatingWebhookConfiguration(ctx, version, configurationNames, ca, failurePolicy); err != nil {
+		err := k8s.patchMutatingWebhookConfiguration(ctx, version, configurationNames, ca, failurePolicy)
+		metrics.ObservePatch(kindMutatingWebhookConfiguration, err)
+		if err != nil {
 			return err
 		}
 	} else {
@@ -202,7 +262,7 @@ func (k8s *K8s) patchValidatingWebhookConfigurationV1beta1(
 		ValidatingWebhookConfigurations().
 		Get(ctx, configurationNames, metav1.GetOptions{})
 	if err != nil {
-		return errors.Wrap(err, "failed getting admissionregistration.k8s.io/v1beta1 validating webhook")
+		return apiError(err, "failed getting admissionregistration.k8s.io/v1beta1 validating webhook")
 	}
 
 	for i := range valHook.Webhooks {
@@ -216,7 +276,7 @@ func (k8s *K8s) patchValidatingWebhookConfigurationV1beta1(
 	if _, err = k8s.clientset.AdmissionregistrationV1beta1().
 		ValidatingWebhookConfigurations().
 		Update(ctx, valHook, metav1.UpdateOptions{}); err != nil {
-		return errors.Wrap(err, "failed patching admissionregistration.k8s.io/v1beta1 validating webhook")
+		return apiError(err, "failed patching admissionregistration.k8s.io/v1beta1 validating webhook")
 	}
 	log.Info("patched admissionregistration.k8s.io/v1beta1 validating hook")
 
@@ -234,7 +294,7 @@ func (k8s *K8s) patchValidatingWebhookConfigurationV1(
 		ValidatingWebhookConfigurations().
 		Get(ctx, configurationNames, metav1.GetOptions{})
 	if err != nil {
-		return errors.Wrap(err, "failed getting admissionregistration.k8s.io/v1 validating webhook")
+		return apiError(err, "failed getting admissionregistration.k8s.io/v1 validating webhook")
 	}
 
 	for i := range valHook.Webhooks {
@@ -248,7 +308,7 @@ func (k8s *K8s) patchValidatingWebhookConfigurationV1(
 	if _, err = k8s.clientset.AdmissionregistrationV1().
 		ValidatingWebhookConfigurations().
 		Update(ctx, valHook, metav1.UpdateOptions{}); err != nil {
-		return errors.Wrap(err, "failed patching admissionregistration.k8s.io/v1 validating webhook")
+		return apiError(err, "failed patching admissionregistration.k8s.io/v1 validating webhook")
 	}
 	log.Info("patched admissionregistration.k8s.io/v1 validating hook")
 
@@ -285,7 +345,7 @@ func (k8s *K8s) patchMutatingWebhookConfigurationV1beta1(
 		MutatingWebhookConfigurations().
 		Get(ctx, configurationNames, metav1.GetOptions{})
 	if err != nil {
-		return errors.Wrap(err, "failed getting admissionregistration.k8s.io/v1beta1 mutating webhook")
+		return apiError(err, "failed getting admissionregistration.k8s.io/v1beta1 mutating webhook")
 	}
 
 	for i := range mutHook.Webhooks {
@@ -299,7 +359,7 @@ func (k8s *K8s) patchMutatingWebhookConfigurationV1beta1(
 	if _, err = k8s.clientset.AdmissionregistrationV1beta1().
 		MutatingWebhookConfigurations().
 		Update(ctx, mutHook, metav1.UpdateOptions{}); err != nil {
-		return errors.Wrap(err, "failed patching admissionregistration.k8s.io/v1beta1 mutating webhook")
+		return apiError(err, "failed patching admissionregistration.k8s.io/v1beta1 mutating webhook")
 	}
 	log.Info("patched admissionregistration.k8s.io/v1beta1 mutating hook")
 
@@ -317,7 +377,7 @@ func (k8s *K8s) patchMutatingWebhookConfigurationV1(
 		MutatingWebhookConfigurations().
 		Get(ctx, configurationNames, metav1.GetOptions{})
 	if err != nil {
-		return errors.Wrap(err, "failed getting admissionregistration.k8s.io/v1 mutating webhook")
+		return apiError(err, "failed getting admissionregistration.k8s.io/v1 mutating webhook")
 	}
 
 	for i := range mutHook.Webhooks {
@@ -331,7 +391,7 @@ func (k8s *K8s) patchMutatingWebhookConfigurationV1(
 	if _, err = k8s.clientset.AdmissionregistrationV1().
 		MutatingWebhookConfigurations().
 		Update(ctx, mutHook, metav1.UpdateOptions{}); err != nil {
-		return errors.Wrap(err, "failed patching admissionregistration.k8s.io/v1 mutating webhook")
+		return apiError(err, "failed patching admissionregistration.k8s.io/v1 mutating webhook")
 	}
 	log.Info("patched admissionregistration.k8s.io/v1 mutating hook")
 
@@ -340,41 +400,59 @@ func (k8s *K8s) patchMutatingWebhookConfigurationV1(
 
 // GetCaFromSecret will check for the presence of a secret. If it exists, will return the content of the
 // "ca" from the secret, otherwise will return nil.
-func (k8s *K8s) GetCaFromSecret(secretName string, namespace string, caName string) ([]byte, error) {
+func (k8s *K8s) GetCaFromSecret(ctx context.Context, secretName, namespace, caName string) ([]byte, error) {
 	log.Debugf("getting secret '%s' in namespace '%s'", secretName, namespace)
-	secret, err := k8s.clientset.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	secret, err := k8s.clientset.CoreV1().Secrets(namespace).Get(ctx, secretName, metav1.GetOptions{})
 	if err != nil {
 		if k8serrors.IsNotFound(err) {
 			log.WithField("err", err).Infof("secret %s/%s does not exist", namespace, secretName)
 			return nil, nil
 		}
-		log.WithField("err", err).Fatal("error getting secret")
+		return nil, apiError(err, "error getting secret %s/%s", namespace, secretName)
 	}
 
 	data := secret.Data[caName]
 	if data == nil {
-		return nil, errors.Errorf("secret %s/%s does not contain '%s' key", namespace, secretName, caName)
+		return nil, malformedSecretError("secret %s/%s does not contain '%s' key", namespace, secretName, caName)
 	}
 	log.Debug("got secret")
 	return data, nil
 }
 
-// SaveCertsToSecret saves the provided ca, cert and key into a secret in the specified namespace.
-func (k8s *K8s) SaveCertsToSecret(ctx context.Context, secretName, namespace, caName, certName, keyName string, ca, cert, key []byte) error {
-	log.Debugf("saving to secret '%s' in namespace '%s'", secretName, namespace)
-	secret := &v1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: secretName,
-		},
-		Data: map[string][]byte{caName: ca, certName: cert, keyName: key},
+// GetCertsFromSecret will check for the presence of a secret. If it exists, will return the content of the
+// ca, cert and key entries of the secret, any of which may be nil when absent. Otherwise will return nil for all.
+func (k8s *K8s) GetCertsFromSecret(
+	ctx context.Context,
+	secretName, namespace, caName, certName, keyName string,
+) (ca, cert, key []byte, err error) {
+	certs, err := k8s.GetCerts(ctx, SecretRef{Namespace: namespace, Name: secretName, CAKey: caName, CertKey: certName, KeyKey: keyName})
+	if err != nil || certs == nil {
+		return nil, nil, nil, err
 	}
+	return certs.CA, certs.Cert, certs.Key, nil
+}
 
-	log.Debug("saving secret")
-	_, err := k8s.clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+// SaveCertsToSecret saves the provided ca, cert and key into a secret in the specified namespace, like SaveCerts
+// with the secret as it is when called.
+func (k8s *K8s) SaveCertsToSecret(
+	ctx context.Context,
+	secretName, namespace, caName, certName, keyName string,
+	ca, cert, key []byte,
+	opts ...SecretOption,
+) error {
+	ref := SecretRef{Namespace: namespace, Name: secretName, CAKey: caName, CertKey: certName, KeyKey: keyName}
+	observed, err := k8s.GetCerts(ctx, ref)
 	if err != nil {
-		return errors.Wrapf(err, "failed creating secret %s/%s", namespace, secretName)
+		return err
 	}
-	log.Debug("saved secret")
+	return k8s.SaveCerts(ctx, ref, &Certs{CA: ca, Cert: cert, Key: key}, observed, opts...)
+}
 
+// Ping checks that the API server is reachable and ready to serve requests with its /readyz endpoint, which every
+// authenticated client may read.
+func (k8s *K8s) Ping(ctx context.Context) error {
+	if err := k8s.clientset.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error(); err != nil {
+		return apiError(err, "api server is not ready")
+	}
 	return nil
 }
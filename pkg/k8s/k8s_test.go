@@ -53,13 +53,41 @@ func TestGetCaFromCertificate(t *testing.T) {
 	_, err := k.clientset.CoreV1().Secrets(testNamespace).Create(context.Background(), secret, metav1.CreateOptions{})
 	assert.NoError(t, err)
 
-	retrievedCa, err := k.GetCaFromSecret(testSecretName, testNamespace, caName)
+	retrievedCa, err := k.GetCaFromSecret(context.Background(), testSecretName, testNamespace, caName)
 	assert.NoError(t, err)
 	if !bytes.Equal(retrievedCa, ca) {
 		t.Error("Was not able to retrieve CA information that was saved")
 	}
 }
 
+func TestGetCertsFromSecret(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+
+	ca, cert, _ := genSecretData()
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: testSecretName,
+		},
+		Data: map[string][]byte{"ca.crt": ca, "cert": cert},
+	}
+
+	_, err := k.clientset.CoreV1().Secrets(testNamespace).Create(context.Background(), secret, metav1.CreateOptions{})
+	assert.NoError(t, err)
+
+	retrievedCa, retrievedCert, retrievedKey, err := k.GetCertsFromSecret(context.Background(), testSecretName, testNamespace, "ca.crt", "cert", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, ca, retrievedCa)
+	assert.Equal(t, cert, retrievedCert)
+	assert.Nil(t, retrievedKey)
+
+	retrievedCa, _, _, err = k.GetCertsFromSecret(context.Background(), "missing", testNamespace, "ca.crt", "cert", "key")
+	assert.NoError(t, err)
+	assert.Nil(t, retrievedCa)
+}
+
 func TestSaveCertsToSecret(t *testing.T) {
 	t.Parallel()
 
@@ -87,6 +115,61 @@ func TestSaveCertsToSecret(t *testing.T) {
 	}
 }
 
+func TestSaveCertsToSecretWithOptions(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+	ca, cert, key := genSecretData()
+	owner := metav1.OwnerReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "webhook", UID: "1234"}
+
+	err := k.SaveCertsToSecret(
+		context.Background(), testSecretName, testNamespace, "ca.crt", "tls.crt", "tls.key", ca, cert, key,
+		WithSecretType(v1.SecretTypeTLS),
+		WithLabels(map[string]string{"app": "webhook"}),
+		WithAnnotations(map[string]string{"note": "generated"}),
+		WithOwnerReference(owner),
+	)
+	assert.NoError(t, err)
+
+	secret, err := k.clientset.CoreV1().Secrets(testNamespace).Get(context.Background(), testSecretName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.SecretTypeTLS, secret.Type)
+	assert.Equal(t, map[string]string{"app": "webhook"}, secret.Labels)
+	assert.Equal(t, map[string]string{"note": "generated"}, secret.Annotations)
+	assert.Equal(t, []metav1.OwnerReference{owner}, secret.OwnerReferences)
+	assert.Equal(t, cert, secret.Data["tls.crt"])
+}
+
+func TestSaveCertsToExistingSecret(t *testing.T) {
+	t.Parallel()
+
+	k := &K8s{clientset: fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        testSecretName,
+			Namespace:   testNamespace,
+			Labels:      map[string]string{"chart": "webhook"},
+			Annotations: map[string]string{"existing": "true"},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{"config": []byte("keep"), "ca.crt": []byte("stale")},
+	})}
+	ca, cert, key := genSecretData()
+
+	err := k.SaveCertsToSecret(
+		context.Background(), testSecretName, testNamespace, "ca.crt", "cert", "key", ca, cert, key,
+		WithSecretType(v1.SecretTypeTLS),
+		WithLabels(map[string]string{"app": "webhook"}),
+	)
+	assert.NoError(t, err)
+
+	secret, err := k.clientset.CoreV1().Secrets(testNamespace).Get(context.Background(), testSecretName, metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.SecretTypeOpaque, secret.Type)
+	assert.Equal(t, map[string]string{"chart": "webhook", "app": "webhook"}, secret.Labels)
+	assert.Equal(t, map[string]string{"existing": "true"}, secret.Annotations)
+	assert.Equal(t, map[string][]byte{"config": []byte("keep"), "ca.crt": ca, "cert": cert, "key": key}, secret.Data)
+}
+
 func TestSaveThenLoadSecret(t *testing.T) {
 	t.Parallel()
 
@@ -101,7 +184,7 @@ func TestSaveThenLoadSecret(t *testing.T) {
 
 	err := k.SaveCertsToSecret(ctx, testSecretName, testNamespace, caName, certName, keyName, ca, cert, key)
 	assert.NoError(t, err)
-	retrievedCert, err := k.GetCaFromSecret(testSecretName, testNamespace, caName)
+	retrievedCert, err := k.GetCaFromSecret(context.Background(), testSecretName, testNamespace, caName)
 	assert.NoError(t, err)
 	if !bytes.Equal(retrievedCert, ca) {
 		t.Error("Was not able to retrieve CA information that was saved")
@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// lockRetryInterval is how often a lock held by someone else is retried.
+	lockRetryInterval = time.Second
+	// unlockTimeout bounds the requests releasing a lock.
+	unlockTimeout = 10 * time.Second
+)
+
+// Lock acquires the Lease name in namespace for holder, waiting up to wait until it is released or expires when it
+// is held by someone else. The lease expires after duration, so a holder that crashes blocks others for at most that
+// long. It is renewed while held, and the returned context, derived from ctx, is cancelled when renewing fails for
+// so long that the lease may expire: work done under the lock must use it. The returned function releases the lease.
+func (k8s *K8s) Lock(ctx context.Context, namespace, name, holder string, duration, wait time.Duration) (context.Context, func(), error) {
+	leases := k8s.clientset.CoordinationV1().Leases(namespace)
+	seconds := int32(duration.Seconds())
+	waitCtx, cancelWait := context.WithTimeout(ctx, wait)
+	defer cancelWait()
+
+	for {
+		now := metav1.NewMicroTime(time.Now())
+		lease, err := leases.Get(waitCtx, name, metav1.GetOptions{})
+		switch {
+		case k8serrors.IsNotFound(err):
+			lease = &coordinationv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Spec: coordinationv1.LeaseSpec{
+					HolderIdentity:       &holder,
+					LeaseDurationSeconds: &seconds,
+					AcquireTime:          &now,
+					RenewTime:            &now,
+				},
+			}
+			lease, err = leases.Create(waitCtx, lease, metav1.CreateOptions{})
+		case err != nil:
+			return nil, nil, apiError(err, "error getting lease %s/%s", namespace, name)
+		case leaseHeld(lease, holder, now.Time):
+			log.Infof("waiting for lease %s/%s held by %s", namespace, name, *lease.Spec.HolderIdentity)
+			err = errLeaseHeld
+		default:
+			lease.Spec.HolderIdentity = &holder
+			lease.Spec.LeaseDurationSeconds = &seconds
+			lease.Spec.AcquireTime = &now
+			lease.Spec.RenewTime = &now
+			lease, err = leases.Update(waitCtx, lease, metav1.UpdateOptions{})
+		}
+
+		if err == nil {
+			log.Debugf("acquired lease %s/%s", namespace, name)
+			held, cancel := context.WithCancel(ctx)
+			renewed := make(chan struct{})
+			go func() {
+				defer close(renewed)
+				k8s.renew(held, cancel, namespace, name, holder, duration)
+			}()
+			return held, func() {
+				cancel()
+				<-renewed
+				k8s.unlock(namespace, name, holder)
+			}, nil
+		}
+		if !errors.Is(err, errLeaseHeld) && !k8serrors.IsAlreadyExists(err) && !k8serrors.IsConflict(err) {
+			return nil, nil, apiError(err, "error acquiring lease %s/%s", namespace, name)
+		}
+
+		select {
+		case <-waitCtx.Done():
+			return nil, nil, errors.Wrapf(waitCtx.Err(), "timed out waiting for lease %s/%s", namespace, name)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+var errLeaseHeld = errors.New("lease is held")
+
+// renew renews the lease every third of duration until ctx is done. When the lease was taken over, or renewing has
+// failed for two thirds of duration, so that it may expire before the next attempt, it cancels ctx.
+func (k8s *K8s) renew(ctx context.Context, cancel context.CancelFunc, namespace, name, holder string, duration time.Duration) {
+	ticker := time.NewTicker(duration / 3)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := k8s.renewLease(ctx, namespace, name, holder)
+		switch {
+		case err == nil:
+			last = time.Now()
+			log.Debugf("renewed lease %s/%s", namespace, name)
+		case errors.Is(err, errLeaseLost):
+			log.WithError(err).Errorf("lost lease %s/%s, cancelling", namespace, name)
+			cancel()
+			return
+		case time.Since(last) >= duration*2/3:
+			log.WithError(err).Errorf("error renewing lease %s/%s before it expires, cancelling", namespace, name)
+			cancel()
+			return
+		default:
+			log.WithError(err).Warnf("error renewing lease %s/%s", namespace, name)
+		}
+	}
+}
+
+var errLeaseLost = errors.New("lease is held by someone else")
+
+// renewLease sets the renew time of the lease to now if it is still held by holder.
+func (k8s *K8s) renewLease(ctx context.Context, namespace, name, holder string) error {
+	leases := k8s.clientset.CoordinationV1().Leases(namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return apiError(err, "error getting lease %s/%s", namespace, name)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return errLeaseLost
+	}
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return apiError(err, "error renewing lease %s/%s", namespace, name)
+	}
+	return nil
+}
+
+// leaseHeld reports whether the lease is held by someone other than holder and has not expired.
+func leaseHeld(lease *coordinationv1.Lease, holder string, now time.Time) bool {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || *spec.HolderIdentity == holder {
+		return false
+	}
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return false
+	}
+	return now.Before(spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second))
+}
+
+// unlock releases the lease if it is still held by holder. Failures only delay the next holder until the lease
+// expires, so they are logged. It does not use the context of Lock, which may be cancelled by then.
+func (k8s *K8s) unlock(namespace, name, holder string) {
+	ctx, cancel := context.WithTimeout(context.Background(), unlockTimeout)
+	defer cancel()
+	leases := k8s.clientset.CoordinationV1().Leases(namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.WithError(err).Warnf("error releasing lease %s/%s", namespace, name)
+		return
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		return
+	}
+	lease.Spec.HolderIdentity = nil
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		log.WithError(err).Warnf("error releasing lease %s/%s", namespace, name)
+		return
+	}
+	log.Debugf("released lease %s/%s", namespace, name)
+}
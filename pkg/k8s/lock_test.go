@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+	ctx := context.Background()
+
+	held, unlock, err := k.Lock(ctx, testNamespace, "lock", "a", time.Minute, time.Minute)
+	assert.NoError(t, err)
+
+	_, _, err = k.Lock(ctx, testNamespace, "lock", "b", time.Minute, 100*time.Millisecond)
+	assert.Error(t, err)
+
+	unlock()
+	assert.Error(t, held.Err())
+	_, unlock, err = k.Lock(ctx, testNamespace, "lock", "b", time.Minute, time.Minute)
+	assert.NoError(t, err)
+	unlock()
+}
+
+func TestLockTakesOverExpiredLease(t *testing.T) {
+	t.Parallel()
+
+	holder := "crashed"
+	seconds := int32(10)
+	renewed := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	k := &K8s{clientset: fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: "lock", Namespace: testNamespace},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewed,
+		},
+	})}
+
+	_, unlock, err := k.Lock(context.Background(), testNamespace, "lock", "a", time.Minute, time.Minute)
+	assert.NoError(t, err)
+	unlock()
+}
+
+func TestLockRenewsLease(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+	leases := k.clientset.CoordinationV1().Leases(testNamespace)
+	held, unlock, err := k.Lock(context.Background(), testNamespace, "lock", "a", 300*time.Millisecond, time.Minute)
+	assert.NoError(t, err)
+	defer unlock()
+	acquired, err := leases.Get(context.Background(), "lock", metav1.GetOptions{})
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		lease, err := leases.Get(context.Background(), "lock", metav1.GetOptions{})
+		return err == nil && lease.Spec.RenewTime.After(acquired.Spec.RenewTime.Time)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.NoError(t, held.Err())
+}
+
+func TestLockCancelsWhenLeaseIsLost(t *testing.T) {
+	t.Parallel()
+
+	k := newTestSimpleK8s()
+	leases := k.clientset.CoordinationV1().Leases(testNamespace)
+	held, unlock, err := k.Lock(context.Background(), testNamespace, "lock", "a", 300*time.Millisecond, time.Minute)
+	assert.NoError(t, err)
+	defer unlock()
+
+	lease, err := leases.Get(context.Background(), "lock", metav1.GetOptions{})
+	assert.NoError(t, err)
+	other := "b"
+	lease.Spec.HolderIdentity = &other
+	_, err = leases.Update(context.Background(), lease, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+
+	select {
+	case <-held.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("context was not cancelled after the lease was lost")
+	}
+}
@@ -0,0 +1,23 @@
+package k8s
+
+import (
+	"os"
+	"strings"
+)
+
+// serviceAccountNamespaceFile is where the namespace of a pod is mounted with its service account token.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// InClusterNamespace returns the namespace of the pod the program runs in, or an empty string when it
+// does not run in a pod.
+func InClusterNamespace() string {
+	return readNamespace(serviceAccountNamespaceFile)
+}
+
+func readNamespace(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,19 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadNamespace(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "namespace")
+	assert.Empty(t, readNamespace(path))
+
+	assert.NoError(t, os.WriteFile(path, []byte("webhooks\n"), 0o600))
+	assert.Equal(t, "webhooks", readNamespace(path))
+}
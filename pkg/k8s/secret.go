@@ -0,0 +1,239 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Default keys of SecretRef.
+const (
+	DefaultCAKey   = "ca.crt"
+	DefaultCertKey = "cert"
+	DefaultKeyKey  = "key"
+)
+
+// SecretRef names a secret and the keys holding its ca, cert and key. Empty keys default to DefaultCAKey,
+// DefaultCertKey and DefaultKeyKey.
+type SecretRef struct {
+	Namespace string
+	Name      string
+	CAKey     string
+	CertKey   string
+	KeyKey    string
+}
+
+func (r SecretRef) String() string {
+	return r.Namespace + "/" + r.Name
+}
+
+func (r SecretRef) keys() (ca, cert, key string) {
+	return valueOr(r.CAKey, DefaultCAKey), valueOr(r.CertKey, DefaultCertKey), valueOr(r.KeyKey, DefaultKeyKey)
+}
+
+// Certs is a PEM encoded ca, cert and key.
+type Certs struct {
+	CA   []byte
+	Cert []byte
+	Key  []byte
+	// ResourceVersion is the version of the secret that GetCerts read the certificates from.
+	ResourceVersion string
+}
+
+// Complete reports whether the ca, cert and key are all set.
+func (c *Certs) Complete() bool {
+	return c != nil && c.CA != nil && c.Cert != nil && c.Key != nil
+}
+
+// SecretOption customizes a secret created by NewSecret or SaveCertsToSecret.
+type SecretOption func(*v1.Secret)
+
+// WithSecretType sets the type of the secret, which is Opaque by default.
+func WithSecretType(secretType v1.SecretType) SecretOption {
+	return func(s *v1.Secret) {
+		s.Type = secretType
+	}
+}
+
+// WithLabels adds labels to the secret.
+func WithLabels(labels map[string]string) SecretOption {
+	return func(s *v1.Secret) {
+		s.Labels = mergeStrings(s.Labels, labels)
+	}
+}
+
+// WithAnnotations adds annotations to the secret.
+func WithAnnotations(annotations map[string]string) SecretOption {
+	return func(s *v1.Secret) {
+		s.Annotations = mergeStrings(s.Annotations, annotations)
+	}
+}
+
+// WithOwnerReference makes the secret owned by the referenced object, so that it is garbage collected with it.
+func WithOwnerReference(owner metav1.OwnerReference) SecretOption {
+	return func(s *v1.Secret) {
+		for _, o := range s.OwnerReferences {
+			if o.UID == owner.UID {
+				return
+			}
+		}
+		s.OwnerReferences = append(s.OwnerReferences, owner)
+	}
+}
+
+// WithData adds keys to the data of the secret, e.g. the certificates in another format. SaveCerts does not let
+// them replace the keys of the ca, cert and key.
+func WithData(data map[string][]byte) SecretOption {
+	return func(s *v1.Secret) {
+		setData(s, data)
+	}
+}
+
+// GetSecretData returns the data of the secret, or nil when the secret does not exist.
+func (k8s *K8s) GetSecretData(ctx context.Context, namespace, name string) (map[string][]byte, error) {
+	log.Debugf("getting secret '%s' in namespace '%s'", name, namespace)
+	secret, err := k8s.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, apiError(err, "error getting secret %s/%s", namespace, name)
+	}
+	if secret.Data == nil {
+		return map[string][]byte{}, nil
+	}
+	return secret.Data, nil
+}
+
+// GetCerts returns the ca, cert and key stored in the secret, any of which is nil when its key is absent. It
+// returns nil when the secret does not exist.
+func (k8s *K8s) GetCerts(ctx context.Context, ref SecretRef) (*Certs, error) {
+	log.Debugf("getting secret '%s' in namespace '%s'", ref.Name, ref.Namespace)
+	secret, err := k8s.clientset.CoreV1().Secrets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			log.WithField("err", err).Infof("secret %s does not exist", ref)
+			return nil, nil
+		}
+		return nil, apiError(err, "error getting secret %s", ref)
+	}
+
+	log.Debug("got secret")
+	caKey, certKey, keyKey := ref.keys()
+	return &Certs{
+		CA:              secret.Data[caKey],
+		Cert:            secret.Data[certKey],
+		Key:             secret.Data[keyKey],
+		ResourceVersion: secret.ResourceVersion,
+	}, nil
+}
+
+// SaveCerts saves the ca, cert and key into the secret, whose content GetCerts returned as observed.
+// When observed is nil, the secret is created, as Opaque unless opts set another type. Otherwise the secret is
+// updated in place: its other keys and metadata are preserved, labels, annotations and owner references of opts are
+// added, and its type, which is immutable, is kept. SaveCerts returns ErrConflict when the secret was created,
+// modified or deleted since it was observed, so that concurrent runs do not overwrite each other.
+func (k8s *K8s) SaveCerts(ctx context.Context, ref SecretRef, certs, observed *Certs, opts ...SecretOption) error {
+	log.Debugf("saving to secret '%s' in namespace '%s'", ref.Name, ref.Namespace)
+	caKey, certKey, keyKey := ref.keys()
+	data := map[string][]byte{caKey: certs.CA, certKey: certs.Cert, keyKey: certs.Key}
+	secrets := k8s.clientset.CoreV1().Secrets(ref.Namespace)
+
+	if observed == nil {
+		log.Debug("creating secret")
+		secret := NewSecret(ref.Name, ref.Namespace, nil, opts...)
+		setData(secret, data)
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return apiError(err, "failed creating secret %s", ref)
+		}
+		log.Debug("created secret")
+		return nil
+	}
+
+	existing, err := secrets.Get(ctx, ref.Name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return deletedSecretError(ref, err)
+	}
+	if err != nil {
+		return apiError(err, "error getting secret %s", ref)
+	}
+
+	log.Debug("updating secret")
+	secret := existing.DeepCopy()
+	for _, opt := range opts {
+		opt(secret)
+	}
+	if secret.Type != existing.Type {
+		log.Warnf("keeping type %s of existing secret %s instead of %s", existing.Type, ref, secret.Type)
+		secret.Type = existing.Type
+	}
+	setData(secret, data)
+	// The API server rejects the update when the secret changed since it was observed.
+	secret.ResourceVersion = observed.ResourceVersion
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		if k8serrors.IsNotFound(err) {
+			return deletedSecretError(ref, err)
+		}
+		return apiError(err, "failed updating secret %s", ref)
+	}
+	log.Debug("updated secret")
+
+	return nil
+}
+
+// deletedSecretError is the ErrConflict of saving a secret that was deleted since it was read.
+func deletedSecretError(ref SecretRef, err error) error {
+	return &Error{msg: fmt.Sprintf("secret %s was deleted since it was read", ref), kind: ErrConflict, err: err}
+}
+
+// NewSecret returns a secret holding data, customized by opts.
+func NewSecret(name, namespace string, data map[string][]byte, opts ...SecretOption) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: data,
+	}
+	for _, opt := range opts {
+		opt(secret)
+	}
+	return secret
+}
+
+func setData(s *v1.Secret, data map[string][]byte) {
+	if len(data) == 0 {
+		return
+	}
+	if s.Data == nil {
+		s.Data = make(map[string][]byte, len(data))
+	}
+	for k, v := range data {
+		s.Data[k] = v
+	}
+}
+
+func valueOr(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+func mergeStrings(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
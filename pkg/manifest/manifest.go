@@ -0,0 +1,141 @@
+package manifest
+
+import (
+	"encoding/base64"
+	"io"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/util"
+)
+
+const decoderBufferSize = 4096
+
+const (
+	groupAdmissionRegistration = "admissionregistration.k8s.io"
+	groupAPIExtensions         = "apiextensions.k8s.io"
+	groupAPIRegistration       = "apiregistration.k8s.io"
+)
+
+// Selector restricts which objects get their caBundle injected. An empty Selector matches every supported object.
+type Selector struct {
+	WebhookNames []string
+	CRDs         []string
+	CRDAPIGroups []string
+	APIServices  []string
+}
+
+func (s Selector) empty() bool {
+	return len(s.WebhookNames) == 0 && len(s.CRDs) == 0 && len(s.CRDAPIGroups) == 0 && len(s.APIServices) == 0
+}
+
+// Decode reads every object of a stream of YAML or JSON documents. Empty documents are skipped.
+func Decode(r io.Reader) ([]*unstructured.Unstructured, error) {
+	var objs []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(r, decoderBufferSize)
+	for {
+		obj := map[string]interface{}{}
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, errors.Wrap(err, "error decoding manifest")
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		objs = append(objs, &unstructured.Unstructured{Object: obj})
+	}
+}
+
+// Encode writes the objects as a stream of YAML documents.
+func Encode(w io.Writer, objs []*unstructured.Unstructured) error {
+	for _, obj := range objs {
+		b, err := sigsyaml.Marshal(obj.Object)
+		if err != nil {
+			return errors.Wrapf(err, "error encoding %s %s", obj.GetKind(), obj.GetName())
+		}
+		if _, err := io.WriteString(w, "---\n"); err != nil {
+			return errors.Wrap(err, "error writing manifest")
+		}
+		if _, err := w.Write(b); err != nil {
+			return errors.Wrap(err, "error writing manifest")
+		}
+	}
+	return nil
+}
+
+// InjectCABundle sets the caBundle of obj to ca when obj is a ValidatingWebhookConfiguration,
+// MutatingWebhookConfiguration, CustomResourceDefinition with a conversion webhook or APIService matched by the
+// selector. It returns whether obj was modified.
+func InjectCABundle(obj *unstructured.Unstructured, ca []byte, selector Selector) (bool, error) {
+	gvk := obj.GroupVersionKind()
+	caBundle := base64.StdEncoding.EncodeToString(ca)
+
+	switch {
+	case gvk.Group == groupAdmissionRegistration &&
+		(gvk.Kind == "ValidatingWebhookConfiguration" || gvk.Kind == "MutatingWebhookConfiguration"):
+		if !selector.empty() && !util.In(selector.WebhookNames, obj.GetName()) {
+			return false, nil
+		}
+		return injectWebhooks(obj, caBundle)
+	case gvk.Group == groupAPIExtensions && gvk.Kind == "CustomResourceDefinition":
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		if !selector.empty() && !util.In(selector.CRDs, obj.GetName()) && !util.In(selector.CRDAPIGroups, group) {
+			return false, nil
+		}
+		if _, found, _ := unstructured.NestedMap(obj.Object, "spec", "conversion", "webhook", "clientConfig"); !found {
+			log.Warnf("skip injecting CustomResourceDefinition %s: spec.conversion.webhook.clientConfig is not defined", obj.GetName())
+			return false, nil
+		}
+		err := unstructured.SetNestedField(obj.Object, caBundle, "spec", "conversion", "webhook", "clientConfig", "caBundle")
+		return err == nil, errors.Wrapf(err, "error injecting CustomResourceDefinition %s", obj.GetName())
+	case gvk.Group == groupAPIRegistration && gvk.Kind == "APIService":
+		if !selector.empty() && !util.In(selector.APIServices, obj.GetName()) {
+			return false, nil
+		}
+		err := unstructured.SetNestedField(obj.Object, caBundle, "spec", "caBundle")
+		return err == nil, errors.Wrapf(err, "error injecting APIService %s", obj.GetName())
+	default:
+		return false, nil
+	}
+}
+
+func injectWebhooks(obj *unstructured.Unstructured, caBundle string) (bool, error) {
+	webhooks, _, err := unstructured.NestedSlice(obj.Object, "webhooks")
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid webhooks in %s %s", obj.GetKind(), obj.GetName())
+	}
+	for i := range webhooks {
+		webhook, ok := webhooks[i].(map[string]interface{})
+		if !ok {
+			return false, errors.Errorf("invalid webhook %d in %s %s", i, obj.GetKind(), obj.GetName())
+		}
+		if err := unstructured.SetNestedField(webhook, caBundle, "clientConfig", "caBundle"); err != nil {
+			return false, errors.Wrapf(err, "error injecting webhook %d in %s %s", i, obj.GetKind(), obj.GetName())
+		}
+	}
+	if err := unstructured.SetNestedSlice(obj.Object, webhooks, "webhooks"); err != nil {
+		return false, errors.Wrapf(err, "error injecting %s %s", obj.GetKind(), obj.GetName())
+	}
+	return len(webhooks) > 0, nil
+}
+
+// Secret returns the manifest of a secret.
+func Secret(secret *v1.Secret) (*unstructured.Unstructured, error) {
+	secret = secret.DeepCopy()
+	secret.SetGroupVersionKind(v1.SchemeGroupVersion.WithKind("Secret"))
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "error converting secret")
+	}
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+	return &unstructured.Unstructured{Object: obj}, nil
+}
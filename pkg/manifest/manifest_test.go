@@ -0,0 +1,135 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testManifests = `
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: v1.example.com
+  clientConfig:
+    service:
+      name: webhook
+      namespace: default
+- name: v2.example.com
+  clientConfig:
+    service:
+      name: webhook
+      namespace: default
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  conversion:
+    strategy: Webhook
+    webhook:
+      clientConfig:
+        service:
+          name: webhook
+          namespace: default
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.com
+spec:
+  group: example.com
+---
+---
+{"apiVersion": "apiregistration.k8s.io/v1", "kind": "APIService", "metadata": {"name": "v1.example.com"}, "spec": {}}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unrelated
+`
+
+func TestDecodeInjectEncode(t *testing.T) {
+	t.Parallel()
+
+	objs, err := Decode(strings.NewReader(testManifests))
+	assert.NoError(t, err)
+	assert.Len(t, objs, 5)
+
+	ca := []byte("ca")
+	caBundle := base64.StdEncoding.EncodeToString(ca)
+
+	var injected []bool
+	for _, obj := range objs {
+		ok, err := InjectCABundle(obj, ca, Selector{})
+		assert.NoError(t, err)
+		injected = append(injected, ok)
+	}
+	assert.Equal(t, []bool{true, true, false, true, false}, injected)
+
+	webhooks, _, _ := unstructured.NestedSlice(objs[0].Object, "webhooks")
+	for _, w := range webhooks {
+		got, _, _ := unstructured.NestedString(w.(map[string]interface{}), "clientConfig", "caBundle")
+		assert.Equal(t, caBundle, got)
+	}
+	got, _, _ := unstructured.NestedString(objs[1].Object, "spec", "conversion", "webhook", "clientConfig", "caBundle")
+	assert.Equal(t, caBundle, got)
+	got, _, _ = unstructured.NestedString(objs[3].Object, "spec", "caBundle")
+	assert.Equal(t, caBundle, got)
+
+	var out bytes.Buffer
+	assert.NoError(t, Encode(&out, objs))
+	decoded, err := Decode(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, objs, decoded)
+}
+
+func TestInjectCABundleWithSelector(t *testing.T) {
+	t.Parallel()
+
+	objs, err := Decode(strings.NewReader(testManifests))
+	assert.NoError(t, err)
+
+	selector := Selector{CRDAPIGroups: []string{"example.com"}}
+	var injected []bool
+	for _, obj := range objs {
+		ok, err := InjectCABundle(obj, []byte("ca"), selector)
+		assert.NoError(t, err)
+		injected = append(injected, ok)
+	}
+	assert.Equal(t, []bool{false, true, false, false, false}, injected)
+}
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+
+	secret, err := Secret(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "certs", Namespace: "default"},
+		Type:       v1.SecretTypeTLS,
+		Data:       map[string][]byte{"ca.crt": []byte("ca")},
+	})
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	assert.NoError(t, Encode(&out, []*unstructured.Unstructured{secret}))
+	assert.Equal(t, `---
+apiVersion: v1
+data:
+  ca.crt: Y2E=
+kind: Secret
+metadata:
+  name: certs
+  namespace: default
+type: kubernetes.io/tls
+`, out.String())
+}
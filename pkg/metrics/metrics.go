@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+const namespace = "certgen"
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	// Registry holds every certgen metric. A dedicated registry is used so that embedding programs
+	// do not get the collectors registered on their default registry.
+	Registry = prometheus.NewRegistry()
+
+	certificateNotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_not_after_timestamp_seconds",
+		Help:      "NotAfter of the serving certificate stored in a secret, as a unix timestamp.",
+	}, []string{"namespace", "secret"})
+
+	caNotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ca_not_after_timestamp_seconds",
+		Help:      "NotAfter of the ca stored in a secret, as a unix timestamp.",
+	}, []string{"namespace", "secret"})
+
+	patchTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "patch_total",
+		Help:      "Number of caBundle patch attempts by object kind and result.",
+	}, []string{"kind", "result"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of a command run by command and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command", "result"})
+)
+
+func init() {
+	Registry.MustRegister(certificateNotAfter, caNotAfter, patchTotal, reconcileDuration)
+}
+
+// ObserveCertificate records the NotAfter of the serving certificate, which is the first certificate found in the
+// PEM encoded data, e.g. the cert of a secret.
+func ObserveCertificate(secretNamespace, secretName string, data []byte) error {
+	return observeNotAfter(certificateNotAfter, secretNamespace, secretName, data)
+}
+
+// ObserveCA records the NotAfter of the ca, which is the first certificate found in the PEM encoded data, e.g. the
+// ca of a secret.
+func ObserveCA(secretNamespace, secretName string, data []byte) error {
+	return observeNotAfter(caNotAfter, secretNamespace, secretName, data)
+}
+
+func observeNotAfter(gauge *prometheus.GaugeVec, secretNamespace, secretName string, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.Errorf("no PEM data found for secret %s/%s", secretNamespace, secretName)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing certificate of secret %s/%s", secretNamespace, secretName)
+	}
+	gauge.WithLabelValues(secretNamespace, secretName).Set(float64(cert.NotAfter.Unix()))
+	return nil
+}
+
+// ObservePatch counts a caBundle patch of an object of the given kind.
+func ObservePatch(kind string, err error) {
+	patchTotal.WithLabelValues(kind, result(err)).Inc()
+}
+
+// ObserveReconcile records how long a command took to run.
+func ObserveReconcile(command string, duration time.Duration, err error) {
+	reconcileDuration.WithLabelValues(command, result(err)).Observe(duration.Seconds())
+}
+
+// Handler returns an http.Handler serving the certgen metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Push sends the current metrics to a Pushgateway-compatible endpoint under the given job name.
+func Push(url, job string) error {
+	if err := push.New(url, job).Gatherer(Registry).Push(); err != nil {
+		return errors.Wrapf(err, "error pushing metrics to %s", url)
+	}
+	return nil
+}
+
+func result(err error) string {
+	if err != nil {
+		return resultFailure
+	}
+	return resultSuccess
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kubeshop/kube-webhook-certgen/pkg/certs"
+)
+
+func TestObserveCertificate(t *testing.T) {
+	t.Parallel()
+
+	ca, err := certs.NewCA()
+	assert.NoError(t, err)
+	cert, _, err := ca.Issue(certs.WithHosts("localhost"), certs.WithValidity(time.Hour))
+	assert.NoError(t, err)
+
+	assert.NoError(t, ObserveCertificate("ns", "secret", cert))
+	assert.NoError(t, ObserveCA("ns", "secret", ca.Certificate()))
+	leaf := testutil.ToFloat64(certificateNotAfter.WithLabelValues("ns", "secret"))
+	assert.InDelta(t, float64(time.Now().Add(time.Hour).Unix()), leaf, 600)
+	assert.Greater(t, testutil.ToFloat64(caNotAfter.WithLabelValues("ns", "secret")), leaf)
+
+	assert.Error(t, ObserveCertificate("ns", "invalid", []byte("not a certificate")))
+	assert.Error(t, ObserveCA("ns", "invalid", nil))
+}
+
+func TestObservePatch(t *testing.T) {
+	t.Parallel()
+
+	ObservePatch("TestKind", nil)
+	ObservePatch("TestKind", nil)
+	ObservePatch("TestKind", errors.New("failed"))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(patchTotal.WithLabelValues("TestKind", resultSuccess)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(patchTotal.WithLabelValues("TestKind", resultFailure)))
+}